@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
 	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/compress"
@@ -15,6 +17,18 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// ErrLockTimeout is returned when another process held the refresh lock for
+// longer than the lock's backoff allowed.
+var ErrLockTimeout = errors.New("timed out waiting for the refresh lock")
+
+// errRefreshedTokenRejected is wrapped when a refreshed token was saved but
+// fails the token checks.
+var errRefreshedTokenRejected = errors.New("refreshed token rejected")
+
+// DefaultRefreshAhead is the refresh-ahead window used by TokenSource
+// when the cache does not configure one.
+const DefaultRefreshAhead = 5 * time.Minute
+
 // Cache to cache credentials
 type Cache struct {
 	storage storage.Storage
@@ -22,6 +36,47 @@ type Cache struct {
 	log     *slog.Logger
 
 	refreshToken func(context.Context, *client.Token) (*client.Token, error)
+	// refreshOnly refreshes without ever authenticating interactively,
+	// used for refreshes ahead of expiry.
+	refreshOnly func(context.Context, *client.Token) (*client.Token, error)
+	// refreshAhead refreshes tokens that are still valid but expire
+	// within this window.
+	refreshAhead time.Duration
+	// checks reject cached tokens that are valid but unsuitable.
+	checks []func(*client.Token) error
+}
+
+// CacheOption configures a Cache.
+type CacheOption func(*Cache)
+
+// WithRefreshAhead refreshes cached tokens that expire within d instead of
+// waiting until they are expired, using the function set with
+// WithNonInteractiveRefresh. If the early refresh fails, the still valid
+// cached token is returned.
+func WithRefreshAhead(d time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.refreshAhead = d
+	}
+}
+
+// WithNonInteractiveRefresh sets the function refreshing tokens ahead of
+// expiry, in Read and in TokenSource's background refresh, e.g.
+// client.OIDCClient.RefreshTokenNonInteractive. It must never start an
+// interactive login, since the cached token is still usable or no user
+// asked for one. Without it, tokens are only refreshed once stale.
+func WithNonInteractiveRefresh(refresh func(context.Context, *client.Token) (*client.Token, error)) CacheOption {
+	return func(c *Cache) {
+		c.refreshOnly = refresh
+	}
+}
+
+// WithTokenCheck treats cached tokens for which check returns an error as
+// stale, e.g. client.AuthenticationRequirement.Check for a step-up login.
+// It can be given more than once; every check must pass.
+func WithTokenCheck(check func(*client.Token) error) CacheOption {
+	return func(c *Cache) {
+		c.checks = append(c.checks, check)
+	}
 }
 
 // NewCache returns a new cache
@@ -30,13 +85,54 @@ func NewCache(
 	storage storage.Storage,
 	refreshToken func(context.Context, *client.Token) (*client.Token, error),
 	lock *pidlock.Lock,
+	opts ...CacheOption,
 ) *Cache {
-	return &Cache{
+	c := &Cache{
 		storage:      storage,
 		refreshToken: refreshToken,
 		lock:         lock,
 		log:          logging.FromContext(ctx),
 	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// isUsable reports whether the token is valid and passes the token check.
+func (c *Cache) isUsable(token *client.Token) bool {
+	if !token.Valid() {
+		return false
+	}
+	err := c.check(token)
+	if err != nil {
+		c.log.Debug("Cache.isUsable: cached token rejected by token check", "reason", err)
+		return false
+	}
+	return true
+}
+
+// check runs the token checks on token.
+func (c *Cache) check(token *client.Token) error {
+	for _, check := range c.checks {
+		err := check(token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isFresh reports whether the token is usable and does not expire within
+// window.
+func (c *Cache) isFresh(token *client.Token, window time.Duration) bool {
+	if !c.isUsable(token) {
+		return false
+	}
+	if window <= 0 || token.Expiry.IsZero() {
+		return true
+	}
+	return time.Until(token.Expiry) > window
 }
 
 // Read will attempt to read a token from the cache.
@@ -47,7 +143,7 @@ func (c *Cache) Read(ctx context.Context) (*client.Token, error) {
 		return nil, err
 	}
 
-	if cachedToken.Valid() {
+	if c.isFresh(cachedToken, c.refreshAhead) {
 		c.log.Debug("Cache.Read: using cached token",
 			"token_expiry", cachedToken.Expiry,
 			"has_refresh_token", cachedToken.RefreshToken != "",
@@ -56,19 +152,56 @@ func (c *Cache) Read(ctx context.Context) (*client.Token, error) {
 		return cachedToken, nil
 	}
 
+	if c.isUsable(cachedToken) {
+		c.log.Debug("Cache.Read: cached token expires within refresh-ahead window, will refresh",
+			"token_expiry", cachedToken.Expiry,
+			"refresh_ahead", c.refreshAhead,
+		)
+		return c.tryRefreshAhead(ctx, cachedToken, c.refreshAhead), nil
+	}
+
 	c.log.Debug("Cache.Read: cached token is stale or empty, will refresh",
 		"token_expiry", cachedToken.Expiry,
 		"has_refresh_token", cachedToken.RefreshToken != "",
 	)
 
-	return c.refresh(ctx)
+	token, err := c.refresh(ctx, 0, c.refreshToken)
+	if errors.Is(err, errRefreshedTokenRejected) {
+		// the rejected token is cached now, and refreshing it again
+		// starts a new login instead of another refresh_token grant
+		c.log.Debug("Cache.Read: refreshed token rejected by token check, will refresh again", "reason", err)
+		return c.refresh(ctx, 0, c.refreshToken)
+	}
+	return token, err
 }
 
-func (c *Cache) refresh(ctx context.Context) (*client.Token, error) {
+// tryRefreshAhead refreshes cachedToken when it expires within window,
+// with the non-interactive refresh function only. On any failure, or
+// without a refresh token or function, cachedToken is returned.
+func (c *Cache) tryRefreshAhead(ctx context.Context, cachedToken *client.Token, window time.Duration) *client.Token {
+	if c.isFresh(cachedToken, window) || c.refreshOnly == nil || cachedToken.RefreshToken == "" {
+		return cachedToken
+	}
+
+	token, err := c.refresh(ctx, window, c.refreshOnly)
+	if err != nil {
+		c.log.Warn("Cache.tryRefreshAhead: refresh ahead of expiry failed, using cached token", "error", err)
+		return cachedToken
+	}
+	return token
+}
+
+// refresh calls refreshToken under the lock, unless another process
+// refreshed the token to outside window while we waited for it.
+func (c *Cache) refresh(
+	ctx context.Context,
+	window time.Duration,
+	refreshToken func(context.Context, *client.Token) (*client.Token, error),
+) (*client.Token, error) {
 	c.log.Debug("Cache.refresh: acquiring lock")
 	err := c.lock.Lock()
 	if err != nil {
-		return nil, err
+		return nil, lockError(err)
 	}
 	defer c.lock.Unlock() //nolint:errcheck
 
@@ -79,7 +212,7 @@ func (c *Cache) refresh(ctx context.Context) (*client.Token, error) {
 		return nil, err
 	}
 
-	if cachedToken.Valid() {
+	if c.isFresh(cachedToken, window) {
 		c.log.Debug("Cache.refresh: token was refreshed by another process",
 			"token_expiry", cachedToken.Expiry,
 		)
@@ -91,7 +224,7 @@ func (c *Cache) refresh(ctx context.Context) (*client.Token, error) {
 		"has_refresh_token", cachedToken.RefreshToken != "",
 	)
 
-	token, err := c.refreshToken(ctx, cachedToken)
+	token, err := refreshToken(ctx, cachedToken)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +233,13 @@ func (c *Cache) refresh(ctx context.Context) (*client.Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	// refreshing keeps the original authentication, so a refreshed token
+	// can still fail the checks. It is saved anyway since its refresh
+	// token may have replaced the cached one.
+	err = c.check(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errRefreshedTokenRejected, err)
+	}
 
 	c.log.Debug("Cache.refresh: completed",
 		"token_expiry", token.Token.Expiry,
@@ -200,3 +340,25 @@ func (c *Cache) DecodeFromStorage(ctx context.Context) (*client.Token, error) {
 	)
 	return cachedToken, nil
 }
+
+// lockHeldMessage is the error pidlock's Lock returns once another process
+// held the lock for its whole backoff. Released pidlock versions have no
+// sentinel error for it, so it is matched on the message.
+const lockHeldMessage = "lock is held by another process"
+
+// lockError wraps a failure to acquire the refresh lock with ErrLockTimeout
+// when it was held by another process.
+func lockError(err error) error {
+	if err != nil && strings.Contains(err.Error(), lockHeldMessage) {
+		return fmt.Errorf("%w: %w", ErrLockTimeout, err)
+	}
+	return err
+}
+
+// AcquireLock locks lock the way the cache does before a refresh, for
+// callers deleting or writing cache entries themselves: when another
+// process held it for the lock's whole backoff, the error wraps
+// ErrLockTimeout.
+func AcquireLock(lock *pidlock.Lock) error {
+	return lockError(lock.Lock())
+}
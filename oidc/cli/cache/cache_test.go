@@ -13,6 +13,7 @@ import (
 	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
 	"golang.org/x/oauth2"
 
+	"github.com/cenkalti/backoff"
 	"github.com/chanzuckerberg/go-misc/pidlock"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
@@ -352,3 +353,192 @@ func TestFileCacheIDTokenRestored(t *testing.T) {
 	r.Equal("test-refresh-token", token.RefreshToken)
 	r.Equal("test@example.com", token.Claims.Email)
 }
+
+func storeTestToken(t *testing.T, s storage.Storage, tok *client.Token) {
+	t.Helper()
+	r := require.New(t)
+
+	marshalled, err := tok.Marshal()
+	r.NoError(err)
+	compressed, err := compress.GzipStr(marshalled)
+	r.NoError(err)
+	r.NoError(s.Set(context.Background(), compressed))
+}
+
+func TestRefreshAhead(t *testing.T) {
+	r := require.New(t)
+	s := genStorage()
+	ctx := context.Background()
+
+	storeTestToken(t, s, &client.Token{
+		IDToken: "old",
+		Token: &oauth2.Token{
+			AccessToken:  "old-access-token",
+			RefreshToken: "refresh-token",
+			Expiry:       time.Now().Add(2 * time.Minute),
+		},
+	})
+
+	fileLock, err := pidlock.NewLock(filepath.Join(t.TempDir(), "lock"))
+	r.NoError(err)
+
+	refresh := func(ctx context.Context, c *client.Token) (*client.Token, error) {
+		return &client.Token{IDToken: "new", Token: &oauth2.Token{Expiry: time.Now().Add(time.Hour)}}, nil
+	}
+
+	// outside the window the cached token is used
+	c := NewCache(ctx, s, failIfCalled(t), fileLock, WithRefreshAhead(time.Minute), WithNonInteractiveRefresh(refresh))
+	token, err := c.Read(ctx)
+	r.NoError(err)
+	r.Equal("old", token.IDToken)
+
+	// inside the window the token is refreshed early
+	c = NewCache(ctx, s, failIfCalled(t), fileLock, WithRefreshAhead(5*time.Minute), WithNonInteractiveRefresh(refresh))
+	token, err = c.Read(ctx)
+	r.NoError(err)
+	r.Equal("new", token.IDToken)
+}
+
+// failIfCalled returns a refresh function standing in for an interactive
+// login, which refreshes ahead of expiry must never start.
+func failIfCalled(t *testing.T) func(context.Context, *client.Token) (*client.Token, error) {
+	return func(context.Context, *client.Token) (*client.Token, error) {
+		t.Error("interactive refresh called")
+		return nil, fmt.Errorf("interactive refresh called")
+	}
+}
+
+func TestRefreshAheadFailureUsesCachedToken(t *testing.T) {
+	r := require.New(t)
+	s := genStorage()
+	ctx := context.Background()
+
+	storeTestToken(t, s, &client.Token{
+		IDToken: "old",
+		Token: &oauth2.Token{
+			AccessToken:  "old-access-token",
+			RefreshToken: "refresh-token",
+			Expiry:       time.Now().Add(2 * time.Minute),
+		},
+	})
+
+	fileLock, err := pidlock.NewLock(filepath.Join(t.TempDir(), "lock"))
+	r.NoError(err)
+
+	refresh := func(ctx context.Context, c *client.Token) (*client.Token, error) {
+		return nil, fmt.Errorf("idp unavailable")
+	}
+
+	c := NewCache(ctx, s, failIfCalled(t), fileLock, WithRefreshAhead(5*time.Minute), WithNonInteractiveRefresh(refresh))
+	token, err := c.Read(ctx)
+	r.NoError(err)
+	r.Equal("old", token.IDToken)
+
+	// without a non-interactive refresh function nothing is refreshed early
+	c = NewCache(ctx, s, failIfCalled(t), fileLock, WithRefreshAhead(5*time.Minute))
+	token, err = c.Read(ctx)
+	r.NoError(err)
+	r.Equal("old", token.IDToken)
+}
+
+func TestTokenCheckRejectsCachedToken(t *testing.T) {
+	r := require.New(t)
+	s := genStorage()
+	ctx := context.Background()
+
+	storeTestToken(t, s, &client.Token{
+		IDToken: "old",
+		Claims:  client.Claims{ACR: "pwd"},
+		Token: &oauth2.Token{
+			AccessToken:  "old-access-token",
+			RefreshToken: "refresh-token",
+			Expiry:       time.Now().Add(time.Hour),
+		},
+	})
+
+	fileLock, err := pidlock.NewLock(filepath.Join(t.TempDir(), "lock"))
+	r.NoError(err)
+
+	refresh := func(ctx context.Context, c *client.Token) (*client.Token, error) {
+		return &client.Token{
+			IDToken: "stepped-up",
+			Claims:  client.Claims{ACR: "phr"},
+			Token:   &oauth2.Token{AccessToken: "new-access-token", Expiry: time.Now().Add(time.Hour)},
+		}, nil
+	}
+	req := &client.AuthenticationRequirement{ACRValues: []string{"phr"}}
+
+	c := NewCache(ctx, s, refresh, fileLock, WithTokenCheck(req.Check))
+	token, err := c.Read(ctx)
+	r.NoError(err)
+	r.Equal("stepped-up", token.IDToken)
+
+	// the stepped up token is now cached and satisfies the check
+	c = NewCache(ctx, s, nil, fileLock, WithTokenCheck(req.Check))
+	token, err = c.Read(ctx)
+	r.NoError(err)
+	r.Equal("stepped-up", token.IDToken)
+}
+
+func TestTokenCheckKeepsRejectedRefresh(t *testing.T) {
+	r := require.New(t)
+	s := genStorage()
+	ctx := context.Background()
+
+	storeTestToken(t, s, &client.Token{
+		IDToken: "old",
+		Claims:  client.Claims{ACR: "phr"},
+		Token: &oauth2.Token{
+			AccessToken:  "old-access-token",
+			RefreshToken: "refresh-token",
+			Expiry:       time.Now().Add(-time.Minute),
+		},
+	})
+
+	fileLock, err := pidlock.NewLock(filepath.Join(t.TempDir(), "lock"))
+	r.NoError(err)
+
+	// the refresh rotates the refresh token but the IdP downgraded the
+	// acr, so the rotated token must be cached and replaced by a login
+	var refreshed []string
+	refresh := func(ctx context.Context, c *client.Token) (*client.Token, error) {
+		refreshed = append(refreshed, c.RefreshToken)
+		if c.RefreshToken == "refresh-token" {
+			return &client.Token{
+				IDToken: "refreshed",
+				Claims:  client.Claims{ACR: "pwd"},
+				Token:   &oauth2.Token{RefreshToken: "rotated", Expiry: time.Now().Add(time.Hour)},
+			}, nil
+		}
+		return &client.Token{
+			IDToken: "stepped-up",
+			Claims:  client.Claims{ACR: "phr"},
+			Token:   &oauth2.Token{AccessToken: "new-access-token", Expiry: time.Now().Add(time.Hour)},
+		}, nil
+	}
+	req := &client.AuthenticationRequirement{ACRValues: []string{"phr"}}
+
+	c := NewCache(ctx, s, refresh, fileLock, WithTokenCheck(req.Check))
+	token, err := c.Read(ctx)
+	r.NoError(err)
+	r.Equal("stepped-up", token.IDToken)
+	r.Equal([]string{"refresh-token", "rotated"}, refreshed)
+}
+
+func TestLockError(t *testing.T) {
+	r := require.New(t)
+
+	lockPath := filepath.Join(t.TempDir(), "test.lock")
+	held, err := pidlock.NewLock(lockPath)
+	r.NoError(err)
+	r.NoError(held.Lock())
+	defer held.Unlock() //nolint:errcheck
+
+	contended, err := pidlock.NewLock(lockPath)
+	r.NoError(err)
+	err = lockError(contended.Lock(&backoff.StopBackOff{}))
+	r.ErrorIs(err, ErrLockTimeout)
+	r.Contains(err.Error(), lockHeldMessage)
+
+	r.NotErrorIs(lockError(fmt.Errorf("permission denied")), ErrLockTimeout)
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+)
+
+const (
+	// backgroundRetryInterval is the delay before retrying a failed
+	// background refresh.
+	backgroundRetryInterval = 30 * time.Second
+)
+
+// TokenSource serves the current token from memory and keeps it fresh by
+// refreshing through the Cache in a background goroutine, ahead of expiry.
+// Token never blocks on the network unless the background refresh has
+// fallen behind and the in-memory token has expired.
+type TokenSource struct {
+	cache   *Cache
+	current atomic.Pointer[client.Token]
+	log     *slog.Logger
+	// refreshAhead is the window before expiry in which the background
+	// goroutine refreshes the token.
+	refreshAhead time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewTokenSource reads a token from c and starts refreshing it in the
+// background until ctx is cancelled or Close is called. Background refreshes
+// use c's WithNonInteractiveRefresh function only, so they never prompt the
+// user, and happen within c's refresh-ahead window of expiry, or
+// DefaultRefreshAhead if c has none.
+func NewTokenSource(ctx context.Context, c *Cache) (*TokenSource, error) {
+	refreshAhead := c.refreshAhead
+	if refreshAhead <= 0 {
+		refreshAhead = DefaultRefreshAhead
+	}
+
+	token, err := c.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, fmt.Errorf("nil token from cache")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ts := &TokenSource{
+		cache:        c,
+		log:          logging.FromContext(ctx),
+		refreshAhead: refreshAhead,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+	ts.current.Store(token)
+
+	go ts.run(ctx)
+	return ts, nil
+}
+
+// Token returns the current token. It only reads through the cache when
+// the in-memory token is no longer valid.
+func (ts *TokenSource) Token(ctx context.Context) (*client.Token, error) {
+	token := ts.current.Load()
+	if ts.cache.isUsable(token) {
+		return token, nil
+	}
+
+	ts.log.Debug("TokenSource.Token: in-memory token expired, reading through cache")
+	token, err := ts.cache.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, fmt.Errorf("nil token from cache")
+	}
+	ts.current.Store(token)
+	return token, nil
+}
+
+// Close stops the background refresh and waits for it to exit.
+func (ts *TokenSource) Close() {
+	ts.cancel()
+	<-ts.done
+}
+
+func (ts *TokenSource) run(ctx context.Context) {
+	defer close(ts.done)
+
+	wait := ts.nextRefresh()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		cachedToken, err := ts.cache.DecodeFromStorage(ctx)
+		if err != nil {
+			ts.log.Warn("TokenSource: background refresh failed", "error", err, "retry_in", backgroundRetryInterval)
+			wait = backgroundRetryInterval
+			continue
+		}
+		// An expired token is left for Token to renew, which may need
+		// the user to log in again.
+		token := ts.cache.tryRefreshAhead(ctx, cachedToken, ts.refreshAhead)
+		if !ts.cache.isUsable(token) {
+			ts.log.Warn("TokenSource: background refresh could not renew the token", "retry_in", backgroundRetryInterval)
+			wait = backgroundRetryInterval
+			continue
+		}
+		ts.current.Store(token)
+
+		wait = ts.nextRefresh()
+		ts.log.Debug("TokenSource: background refresh completed",
+			"token_expiry", token.Expiry,
+			"next_refresh_in", wait,
+		)
+	}
+}
+
+// nextRefresh returns how long to wait before the current token enters
+// the refresh-ahead window.
+func (ts *TokenSource) nextRefresh() time.Duration {
+	token := ts.current.Load()
+	if token.Expiry.IsZero() {
+		// never expires; nothing to refresh
+		return time.Duration(1<<63 - 1)
+	}
+
+	wait := time.Until(token.Expiry) - ts.refreshAhead
+	if wait < 0 {
+		// the token is already inside the window, e.g. the early refresh
+		// failed and the cache handed back the still valid token
+		return backgroundRetryInterval
+	}
+	return wait
+}
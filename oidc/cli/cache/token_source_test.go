@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/pidlock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenSourceBackgroundRefresh(t *testing.T) {
+	r := require.New(t)
+	s := genStorage()
+	ctx := context.Background()
+
+	fileLock, err := pidlock.NewLock(filepath.Join(t.TempDir(), "lock"))
+	r.NoError(err)
+
+	login := func(ctx context.Context, c *client.Token) (*client.Token, error) {
+		// first token enters the refresh-ahead window almost immediately
+		return &client.Token{
+			IDToken: "token",
+			Token: &oauth2.Token{
+				AccessToken:  "access",
+				RefreshToken: "refresh",
+				Expiry:       time.Now().Add(time.Minute + 200*time.Millisecond),
+			},
+		}, nil
+	}
+	var refreshes atomic.Int32
+	refresh := func(ctx context.Context, c *client.Token) (*client.Token, error) {
+		refreshes.Add(1)
+		return &client.Token{
+			IDToken: "token",
+			Token: &oauth2.Token{
+				AccessToken:  "access",
+				RefreshToken: "refresh",
+				Expiry:       time.Now().Add(time.Hour),
+			},
+		}, nil
+	}
+
+	c := NewCache(ctx, s, login, fileLock, WithRefreshAhead(time.Minute), WithNonInteractiveRefresh(refresh))
+	ts, err := NewTokenSource(ctx, c)
+	r.NoError(err)
+	defer ts.Close()
+
+	token, err := ts.Token(ctx)
+	r.NoError(err)
+	r.WithinDuration(time.Now().Add(time.Minute), token.Expiry, 5*time.Second)
+
+	r.Eventually(func() bool {
+		token, err := ts.Token(ctx)
+		return err == nil && time.Until(token.Expiry) > 30*time.Minute
+	}, 5*time.Second, 50*time.Millisecond)
+	r.Equal(int32(1), refreshes.Load())
+}
+
+func TestTokenSourceBackgroundRefreshNeverInteractive(t *testing.T) {
+	r := require.New(t)
+	s := genStorage()
+	ctx := context.Background()
+
+	storeTestToken(t, s, &client.Token{
+		IDToken: "cached",
+		Token: &oauth2.Token{
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			Expiry:       time.Now().Add(time.Minute + 200*time.Millisecond),
+		},
+	})
+	fileLock, err := pidlock.NewLock(filepath.Join(t.TempDir(), "lock"))
+	r.NoError(err)
+
+	var refreshes atomic.Int32
+	refresh := func(ctx context.Context, c *client.Token) (*client.Token, error) {
+		refreshes.Add(1)
+		return nil, fmt.Errorf("refresh token revoked")
+	}
+
+	c := NewCache(ctx, s, failIfCalled(t), fileLock, WithRefreshAhead(time.Minute), WithNonInteractiveRefresh(refresh))
+	ts, err := NewTokenSource(ctx, c)
+	r.NoError(err)
+
+	r.Eventually(func() bool { return refreshes.Load() > 0 }, 5*time.Second, 50*time.Millisecond)
+	ts.Close()
+
+	token, err := ts.Token(ctx)
+	r.NoError(err)
+	r.Equal("cached", token.IDToken)
+}
+
+func TestTokenSourceDefaultRefreshAhead(t *testing.T) {
+	r := require.New(t)
+	s := genStorage()
+	ctx := context.Background()
+
+	fileLock, err := pidlock.NewLock(filepath.Join(t.TempDir(), "lock"))
+	r.NoError(err)
+
+	refresh := func(ctx context.Context, c *client.Token) (*client.Token, error) {
+		return &client.Token{Token: &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}}, nil
+	}
+
+	c := NewCache(ctx, s, refresh, fileLock)
+	ts, err := NewTokenSource(ctx, c)
+	r.NoError(err)
+	ts.Close()
+
+	r.Equal(DefaultRefreshAhead, ts.refreshAhead)
+	r.Zero(c.refreshAhead, "the cache's own refresh-ahead window is left unchanged")
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// AuthorizationError is an error response from the IdP to an authorization
+// request, redirected to the callback (RFC 6749 section 4.1.2.1, OpenID
+// Connect Core section 3.1.2.6) or returned while polling in the device
+// flow (RFC 8628 section 3.5).
+type AuthorizationError struct {
+	// Code is the error parameter, e.g. access_denied.
+	Code        string
+	Description string
+	URI         string
+}
+
+func (e *AuthorizationError) Error() string {
+	msg := fmt.Sprintf("identity provider returned error %q", e.Code)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.URI != "" {
+		msg += " (see " + e.URI + ")"
+	}
+	return msg
+}
+
+// Is matches AuthorizationErrors by Code, so that
+// errors.Is(err, ErrAccessDenied) holds whatever the description.
+func (e *AuthorizationError) Is(target error) bool {
+	t, ok := target.(*AuthorizationError)
+	return ok && t.Code == e.Code
+}
+
+// Errors the IdP may respond with, to be checked with errors.Is.
+var (
+	// ErrAccessDenied means the user declined, or isn't assigned to the
+	// application.
+	ErrAccessDenied = &AuthorizationError{Code: "access_denied"}
+	// ErrConsentRequired, ErrLoginRequired, ErrInteractionRequired and
+	// ErrAccountSelectionRequired mean the IdP needs the user to act, see
+	// OpenID Connect Core section 3.1.2.6.
+	ErrConsentRequired          = &AuthorizationError{Code: "consent_required"}
+	ErrLoginRequired            = &AuthorizationError{Code: "login_required"}
+	ErrInteractionRequired      = &AuthorizationError{Code: "interaction_required"}
+	ErrAccountSelectionRequired = &AuthorizationError{Code: "account_selection_required"}
+	// ErrUnauthorizedClient and ErrInvalidScope point to a misconfigured
+	// client.
+	ErrUnauthorizedClient = &AuthorizationError{Code: "unauthorized_client"}
+	ErrInvalidScope       = &AuthorizationError{Code: "invalid_scope"}
+	// ErrServerError and ErrTemporarilyUnavailable are failures of the IdP
+	// that may be worth retrying.
+	ErrServerError            = &AuthorizationError{Code: "server_error"}
+	ErrTemporarilyUnavailable = &AuthorizationError{Code: "temporarily_unavailable"}
+	// ErrExpiredToken means the device code expired before the user
+	// approved it.
+	ErrExpiredToken = &AuthorizationError{Code: "expired_token"}
+)
+
+// deviceAuthorizationError converts the error response ending the device
+// flow's polling to an AuthorizationError, wrapping other errors with
+// ErrIdPUnreachable where they apply.
+func deviceAuthorizationError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) || retrieveErr.ErrorCode == "" {
+		return idpRequestError(err)
+	}
+	return &AuthorizationError{
+		Code:        retrieveErr.ErrorCode,
+		Description: retrieveErr.ErrorDescription,
+		URI:         retrieveErr.ErrorURI,
+	}
+}
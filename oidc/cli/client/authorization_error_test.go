@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestAuthorizationErrorIs(t *testing.T) {
+	r := require.New(t)
+
+	err := fmt.Errorf("authenticating: %w", &AuthorizationError{Code: "access_denied", Description: "User declined"})
+	r.ErrorIs(err, ErrAccessDenied)
+	r.NotErrorIs(err, ErrConsentRequired)
+	r.Equal(`authenticating: identity provider returned error "access_denied": User declined`, err.Error())
+
+	var authzErr *AuthorizationError
+	r.True(errors.As(err, &authzErr))
+	r.Equal("User declined", authzErr.Description)
+}
+
+func TestCallbackIdPErrorFromWait(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	a, redirectURL, material := startCallbackServer(t, idp.client(t))
+
+	getCallback(t, redirectURL, url.Values{
+		"error":             {"consent_required"},
+		"error_description": {"Admin consent is needed"},
+		"error_uri":         {"https://idp.example.com/help"},
+		"state":             {material.State},
+	})
+
+	_, err := a.server.Wait(context.Background())
+	r.ErrorIs(err, ErrConsentRequired)
+	r.NotErrorIs(err, errStateMismatch)
+	r.NotErrorIs(err, ErrAuthenticatorUnavailable)
+	r.Contains(err.Error(), "(see https://idp.example.com/help)")
+}
+
+func TestDeviceAuthorizationError(t *testing.T) {
+	r := require.New(t)
+
+	err := deviceAuthorizationError(&oauth2.RetrieveError{ErrorCode: "expired_token", ErrorDescription: "too late"})
+	r.ErrorIs(err, ErrExpiredToken)
+	r.Contains(err.Error(), "too late")
+
+	other := errors.New("connection refused")
+	r.Equal(other, deviceAuthorizationError(other))
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"html/template"
 	"io"
 	"os"
 	"time"
@@ -17,8 +18,24 @@ type oidcStatus string
 const (
 	defaultSuccessMessage            = "Signed in successfully! You can now return to CLI."
 	oidcStatusSuccess     oidcStatus = "success"
+
+	// failures shown on the callback page
+	oidcStatusStateMismatch  oidcStatus = "state_mismatch"
+	oidcStatusIdPError       oidcStatus = "idp_error"
+	oidcStatusExchangeFailed oidcStatus = "exchange_failed"
+	oidcStatusInvalidToken   oidcStatus = "invalid_token"
 )
 
+// defaultCallbackMessages are used for the statuses missing from
+// ServerConfig.CustomMessages.
+var defaultCallbackMessages = map[oidcStatus]string{
+	oidcStatusSuccess:        defaultSuccessMessage,
+	oidcStatusStateMismatch:  "The sign-in response did not match the request from the CLI, it may have been started from another window.",
+	oidcStatusIdPError:       "The identity provider did not sign you in.",
+	oidcStatusExchangeFailed: "The CLI could not redeem the authorization code with the identity provider.",
+	oidcStatusInvalidToken:   "The identity provider returned a token the CLI could not verify.",
+}
+
 var DefaultAuthorizationGrantConfig *AuthorizationGrantConfig = &AuthorizationGrantConfig{
 	ServerConfig: &ServerConfig{
 		FromPort: 49152,
@@ -44,7 +61,28 @@ type AuthorizationGrantAuthenticatorOption func(*AuthorizationGrantAuthenticator
 
 func WithSuccessMessage(successMsg string) AuthorizationGrantAuthenticatorOption {
 	return func(a *AuthorizationGrantAuthenticator) {
-		a.server.config.CustomMessages[oidcStatusSuccess] = successMsg
+		a.server.messages[oidcStatusSuccess] = successMsg
+	}
+}
+
+// WithErrorMessage sets the message of the callback page for every
+// failure. The IdP's error and error_description are still shown.
+func WithErrorMessage(errorMsg string) AuthorizationGrantAuthenticatorOption {
+	return func(a *AuthorizationGrantAuthenticator) {
+		for status := range defaultCallbackMessages {
+			if status != oidcStatusSuccess {
+				a.server.messages[status] = errorMsg
+			}
+		}
+	}
+}
+
+// WithCallbackPageTemplate replaces the HTML page shown in the browser
+// once the authorization code flow completes or fails. It is executed
+// with a *CallbackPageData.
+func WithCallbackPageTemplate(tmpl *template.Template) AuthorizationGrantAuthenticatorOption {
+	return func(a *AuthorizationGrantAuthenticator) {
+		a.server.page = tmpl
 	}
 }
 
@@ -78,20 +116,25 @@ func (c *AuthorizationGrantAuthenticator) GetBoundPort() int {
 
 // GetAuthCodeURL gets the url to the oauth2 consent page
 func (c *AuthorizationGrantAuthenticator) GetAuthCodeURL(oauthMaterial *oauthMaterial, client *OIDCClient) string {
-	return client.AuthCodeURL(
-		oauthMaterial.State,
+	return client.AuthCodeURL(oauthMaterial.State, authCodeURLOptions(client, oauthMaterial)...)
+}
+
+// authCodeURLOptions are the PKCE and nonce parameters of the authorization
+// request, along with those of the client's authentication requirement.
+func authCodeURLOptions(client *OIDCClient, oauthMaterial *oauthMaterial) []oauth2.AuthCodeOption {
+	return append([]oauth2.AuthCodeOption{
 		oauth2.SetAuthURLParam("grant_type", "refresh_token"),
 		oauth2.SetAuthURLParam("code_challenge", oauthMaterial.CodeChallenge),
 		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
 		oauth2.SetAuthURLParam("nonce", oauthMaterial.Nonce),
-	)
+	}, client.requirement.authCodeOptions()...)
 }
 
 // Authenticate will authenticate authenticate with the idp
 func (c *AuthorizationGrantAuthenticator) Authenticate(ctx context.Context, client *OIDCClient) (*Token, error) {
 	err := c.server.Bind()
 	if err != nil {
-		return nil, fmt.Errorf("binding to port: %w", err)
+		return nil, fmt.Errorf("binding to port: %w: %w", ErrAuthenticatorUnavailable, err)
 	}
 
 	client.RedirectURL = fmt.Sprintf("http://localhost:%d", c.GetBoundPort())
@@ -103,7 +146,8 @@ func (c *AuthorizationGrantAuthenticator) Authenticate(ctx context.Context, clie
 
 	c.server.Start(ctx, client, oauthMaterial)
 
-	fmt.Fprintf(os.Stderr, "Opening browser in order to authenticate with Okta, hold on a brief second...\n")
+	authURL := c.GetAuthCodeURL(oauthMaterial, client)
+	client.prompter.OpeningBrowser(ctx, authURL)
 	time.Sleep(2 * time.Second)
 
 	// intercept these outputs, send them back on error
@@ -112,13 +156,13 @@ func (c *AuthorizationGrantAuthenticator) Authenticate(ctx context.Context, clie
 	browser.Stdout = browserStdOut
 	browser.Stderr = browserStdErr
 
-	authURL := c.GetAuthCodeURL(oauthMaterial, client)
 	err = browser.OpenURL(authURL)
 	if err != nil {
 		// if we error out, send back stdout, stderr
 		io.Copy(os.Stdout, browserStdOut) //nolint:errcheck
 		io.Copy(os.Stderr, browserStdErr) //nolint:errcheck
-		return nil, fmt.Errorf("opening browser: %w", err)
+		c.server.server.Shutdown(ctx)     //nolint:errcheck
+		return nil, fmt.Errorf("opening browser: %w: %w", ErrAuthenticatorUnavailable, err)
 	}
 
 	token, err := c.server.Wait(ctx)
@@ -126,6 +170,6 @@ func (c *AuthorizationGrantAuthenticator) Authenticate(ctx context.Context, clie
 		return nil, err
 	}
 
-	fmt.Fprintf(os.Stderr, "Successfully authenticated!\n")
+	client.prompter.Authenticated(ctx, token)
 	return token, nil
 }
@@ -1,11 +1,15 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
@@ -34,6 +38,10 @@ type server struct {
 	config *ServerConfig
 	log    *slog.Logger
 
+	// messages and page render the callback page
+	messages map[oidcStatus]string
+	page     *template.Template
+
 	listener *net.Listener
 	port     int
 	server   *http.Server
@@ -45,10 +53,19 @@ type server struct {
 // newServer returns a new server
 func newServer(ctx context.Context, c *ServerConfig) (*server, error) {
 	s := &server{
-		config: c,
-		log:    logging.FromContext(ctx),
-		result: make(chan *Token, 1),
-		err:    make(chan error, 1),
+		config:   c,
+		log:      logging.FromContext(ctx),
+		messages: make(map[oidcStatus]string, len(defaultCallbackMessages)),
+		page:     defaultCallbackPageTemplate,
+		result:   make(chan *Token, 1),
+		err:      make(chan error, 1),
+	}
+	// copied so options don't modify a shared config
+	for status, msg := range defaultCallbackMessages {
+		s.messages[status] = msg
+	}
+	for status, msg := range c.CustomMessages {
+		s.messages[status] = msg
 	}
 
 	err := c.Validate()
@@ -81,6 +98,11 @@ func (s *server) Bind() error {
 }
 
 func (s *server) Exchange(ctx context.Context, client *OIDCClient, code, codeVerifier string) (*oauth2.Token, error) {
+	return exchangeCode(ctx, client, code, codeVerifier)
+}
+
+// exchangeCode exchanges an authorization code using the PKCE verifier.
+func exchangeCode(ctx context.Context, client *OIDCClient, code, codeVerifier string) (*oauth2.Token, error) {
 	token, err := client.Exchange(
 		ctx,
 		code,
@@ -89,7 +111,7 @@ func (s *server) Exchange(ctx context.Context, client *OIDCClient, code, codeVer
 		oauth2.SetAuthURLParam("client_id", client.ClientID),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("exchanging oauth token: %w", err)
+		return nil, fmt.Errorf("exchanging oauth token: %w", idpRequestError(err))
 	}
 
 	return token, nil
@@ -112,61 +134,25 @@ func (s *server) Start(
 			"has_state", req.URL.Query().Get("state") != "",
 		)
 
-		if !bytesAreEqual(oauthMaterial.StateBytes, []byte(req.URL.Query().Get("state"))) {
-			s.log.Debug("server.Start: state parameter mismatch")
-			http.Error(w, "state did not match", http.StatusBadRequest)
-			s.err <- fmt.Errorf("state did not match")
-			return
-		}
-
-		s.log.Debug("server.Start: exchanging authorization code for token")
-		oauth2Token, err := s.Exchange(ctx, client, req.URL.Query().Get("code"), oauthMaterial.CodeVerifier)
+		token, err := completeAuthorization(ctx, client, oauthMaterial, req.URL.Query())
 		if err != nil {
-			http.Error(w, "failed to exchange token", http.StatusInternalServerError)
-			s.err <- fmt.Errorf("failed to exchange token: %w", err)
-			return
-		}
-
-		s.log.Debug("server.Start: token exchange successful",
-			"token_expiry", oauth2Token.Expiry,
-			"has_refresh_token", oauth2Token.RefreshToken != "",
-		)
-
-		claims, verifiedIDToken, verifiedIDStr, err := client.ParseAsIDToken(ctx, oauth2Token)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			s.err <- fmt.Errorf("could not verify ID token: %w", err)
-			return
-		}
-
-		if verifiedIDToken == nil {
-			s.log.Warn("server.Start: ID token not found")
-			s.err <- fmt.Errorf("ID token not found")
-			return
-		}
-
-		if !bytesAreEqual([]byte(verifiedIDToken.Nonce), oauthMaterial.NonceBytes) {
-			s.log.Debug("server.Start: nonce mismatch")
-			s.err <- fmt.Errorf("nonce does not match")
+			s.writePage(w, err)
+			s.err <- err
 			return
 		}
 
-		_, err = w.Write([]byte(s.config.CustomMessages[oidcStatusSuccess]))
+		err = s.writePage(w, nil)
 		if err != nil {
 			s.err <- err
 			return
 		}
 
 		s.log.Debug("server.Start: OAuth flow completed successfully",
-			"email", claims.Email,
-			"token_expiry", oauth2Token.Expiry,
+			"email", token.Claims.Email,
+			"token_expiry", token.Expiry,
 		)
 
-		s.result <- &Token{
-			IDToken: verifiedIDStr,
-			Claims:  *claims,
-			Token:   oauth2Token,
-		}
+		s.result <- token
 	})
 
 	s.server = &http.Server{
@@ -183,6 +169,131 @@ func (s *server) Start(
 	}()
 }
 
+// writePage renders the callback page for the outcome of the flow.
+func (s *server) writePage(w http.ResponseWriter, flowErr error) error {
+	data := &CallbackPageData{
+		Status:  string(oidcStatusSuccess),
+		Success: true,
+		Title:   "Signed in",
+	}
+	code := http.StatusOK
+
+	if flowErr != nil {
+		status := oidcStatusInvalidToken
+		var cbErr *callbackError
+		if errors.As(flowErr, &cbErr) {
+			status = cbErr.status
+		}
+		data = &CallbackPageData{
+			Status: string(status),
+			Title:  "Sign in failed",
+		}
+		code = http.StatusInternalServerError
+		switch status {
+		case oidcStatusStateMismatch:
+			code = http.StatusBadRequest
+		case oidcStatusIdPError:
+			code = http.StatusUnauthorized
+			var authzErr *AuthorizationError
+			if errors.As(flowErr, &authzErr) {
+				data.Error = authzErr.Code
+				data.ErrorDescription = authzErr.Description
+			}
+		case oidcStatusExchangeFailed:
+			code = http.StatusBadGateway
+		}
+	}
+	data.Message = s.messages[oidcStatus(data.Status)]
+
+	var buf bytes.Buffer
+	err := renderCallbackPage(&buf, s.page, data)
+	if err != nil {
+		s.log.Warn("server.writePage: rendering callback page failed", "error", err)
+		http.Error(w, data.Message, code)
+		return fmt.Errorf("rendering callback page: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// errStateMismatch is returned when the state of an authorization response
+// does not match the request's.
+var errStateMismatch = errors.New("state did not match")
+
+// callbackError is a failed authorization response along with the status
+// of the page to show for it.
+type callbackError struct {
+	status oidcStatus
+	err    error
+}
+
+func (e *callbackError) Error() string { return e.err.Error() }
+
+func (e *callbackError) Unwrap() error { return e.err }
+
+// completeAuthorization validates an authorization response's state,
+// exchanges its code using the PKCE verifier, and verifies the returned ID
+// token and its nonce. Both the callback server and the manual flow use it.
+func completeAuthorization(
+	ctx context.Context,
+	client *OIDCClient,
+	oauthMaterial *oauthMaterial,
+	query url.Values,
+) (*Token, error) {
+	// the state is checked before anything else, error responses included:
+	// otherwise a forged redirect (CSRF) could abort the login with an IdP
+	// error. RFC 6749 requires IdPs to return the state with errors too, so
+	// error responses without one are rejected as mismatched.
+	if !bytesAreEqual(oauthMaterial.StateBytes, []byte(query.Get("state"))) {
+		client.log.Debug("completeAuthorization: state parameter mismatch")
+		return nil, &callbackError{status: oidcStatusStateMismatch, err: errStateMismatch}
+	}
+
+	if idpError := query.Get("error"); idpError != "" {
+		client.log.Debug("completeAuthorization: identity provider returned an error", "error", idpError)
+		return nil, &callbackError{status: oidcStatusIdPError, err: &AuthorizationError{
+			Code:        idpError,
+			Description: query.Get("error_description"),
+			URI:         query.Get("error_uri"),
+		}}
+	}
+
+	client.log.Debug("completeAuthorization: exchanging authorization code for token")
+	oauth2Token, err := exchangeCode(ctx, client, query.Get("code"), oauthMaterial.CodeVerifier)
+	if err != nil {
+		return nil, &callbackError{status: oidcStatusExchangeFailed, err: fmt.Errorf("failed to exchange token: %w", err)}
+	}
+
+	client.log.Debug("completeAuthorization: token exchange successful",
+		"token_expiry", oauth2Token.Expiry,
+		"has_refresh_token", oauth2Token.RefreshToken != "",
+	)
+
+	claims, verifiedIDToken, verifiedIDStr, err := client.ParseAsIDToken(ctx, oauth2Token)
+	if err != nil {
+		return nil, fmt.Errorf("could not verify ID token: %w", err)
+	}
+
+	if verifiedIDToken == nil {
+		client.log.Warn("completeAuthorization: ID token not found")
+		return nil, fmt.Errorf("ID token not found")
+	}
+
+	if !bytesAreEqual([]byte(verifiedIDToken.Nonce), oauthMaterial.NonceBytes) {
+		client.log.Debug("completeAuthorization: nonce mismatch")
+		return nil, fmt.Errorf("nonce does not match")
+	}
+
+	return &Token{
+		IDToken: verifiedIDStr,
+		Claims:  *claims,
+		Token:   oauth2Token,
+	}, nil
+}
+
 // Wait waits for the oauth2 payload
 func (s *server) Wait(ctx context.Context) (*Token, error) {
 	s.log.Debug("server.Wait: waiting for OAuth callback", "timeout", s.config.Timeout)
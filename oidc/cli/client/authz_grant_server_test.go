@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startCallbackServer starts a callback server on a free port for client
+// and returns its URL along with the material it expects.
+func startCallbackServer(t *testing.T, client *OIDCClient, options ...AuthorizationGrantAuthenticatorOption) (*AuthorizationGrantAuthenticator, string, *oauthMaterial) {
+	t.Helper()
+	r := require.New(t)
+	ctx := context.Background()
+
+	a, err := NewAuthorizationGrantAuthenticator(ctx, &AuthorizationGrantConfig{
+		ServerConfig: &ServerConfig{Timeout: 5 * time.Second},
+	}, client.Config, options...)
+	r.NoError(err)
+
+	l, err := net.Listen("tcp", "localhost:0")
+	r.NoError(err)
+	a.server.listener = &l
+	a.server.port = l.Addr().(*net.TCPAddr).Port
+	client.RedirectURL = fmt.Sprintf("http://localhost:%d", a.server.port)
+
+	material, err := newOauthMaterial()
+	r.NoError(err)
+	a.server.Start(ctx, client, material)
+	t.Cleanup(func() { a.server.server.Close() })
+
+	return a, client.RedirectURL, material
+}
+
+func getCallback(t *testing.T, redirectURL string, query url.Values) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.Get(redirectURL + "/?" + query.Encode())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestCallbackPageSuccess(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	a, redirectURL, material := startCallbackServer(t, idp.client(t), WithSuccessMessage("Welcome back"))
+	idp.setNonce(material.Nonce)
+
+	resp, body := getCallback(t, redirectURL, url.Values{"code": {"valid-code"}, "state": {material.State}})
+	r.Equal(http.StatusOK, resp.StatusCode)
+	r.Contains(resp.Header.Get("Content-Type"), "text/html")
+	r.Contains(body, "Welcome back")
+
+	token, err := a.server.Wait(context.Background())
+	r.NoError(err)
+	r.Equal("user@example.com", token.Claims.Email)
+	r.Equal(defaultSuccessMessage, DefaultAuthorizationGrantConfig.ServerConfig.CustomMessages[oidcStatusSuccess])
+}
+
+func TestCallbackPageFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    func(material *oauthMaterial) url.Values
+		nonce    string
+		code     int
+		contains string
+	}{
+		{
+			name: "idp error",
+			query: func(material *oauthMaterial) url.Values {
+				return url.Values{
+					"error":             {"access_denied"},
+					"error_description": {"User <b>declined</b> consent"},
+					"state":             {material.State},
+				}
+			},
+			code:     http.StatusUnauthorized,
+			contains: "<code>access_denied</code>: User &lt;b&gt;declined&lt;/b&gt; consent",
+		},
+		{
+			name: "state mismatch",
+			query: func(material *oauthMaterial) url.Values {
+				return url.Values{"code": {"valid-code"}, "state": {"forged"}}
+			},
+			code:     http.StatusBadRequest,
+			contains: defaultCallbackMessages[oidcStatusStateMismatch],
+		},
+		{
+			name: "idp error with forged state",
+			query: func(material *oauthMaterial) url.Values {
+				return url.Values{"error": {"access_denied"}, "state": {"forged"}}
+			},
+			code:     http.StatusBadRequest,
+			contains: defaultCallbackMessages[oidcStatusStateMismatch],
+		},
+		{
+			name: "idp error without state",
+			query: func(material *oauthMaterial) url.Values {
+				return url.Values{"error": {"access_denied"}}
+			},
+			code:     http.StatusBadRequest,
+			contains: defaultCallbackMessages[oidcStatusStateMismatch],
+		},
+		{
+			name: "exchange failure",
+			query: func(material *oauthMaterial) url.Values {
+				return url.Values{"code": {"expired-code"}, "state": {material.State}}
+			},
+			code:     http.StatusBadGateway,
+			contains: defaultCallbackMessages[oidcStatusExchangeFailed],
+		},
+		{
+			name: "nonce mismatch",
+			query: func(material *oauthMaterial) url.Values {
+				return url.Values{"code": {"valid-code"}, "state": {material.State}}
+			},
+			nonce:    "replayed",
+			code:     http.StatusInternalServerError,
+			contains: defaultCallbackMessages[oidcStatusInvalidToken],
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			idp := newFakeIdP(t)
+			a, redirectURL, material := startCallbackServer(t, idp.client(t))
+			idp.setNonce(test.nonce)
+
+			resp, body := getCallback(t, redirectURL, test.query(material))
+			r.Equal(test.code, resp.StatusCode)
+			r.Contains(body, "Sign in failed")
+			r.Contains(body, test.contains)
+
+			_, err := a.server.Wait(context.Background())
+			r.Error(err)
+		})
+	}
+}
+
+func TestCallbackPageTemplate(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	tmpl := template.Must(template.New("page").Parse(`{{ .Status }}|{{ .Message }}|{{ .Error }}`))
+	a, redirectURL, material := startCallbackServer(t, idp.client(t),
+		WithCallbackPageTemplate(tmpl),
+		WithErrorMessage("Ask #help"),
+	)
+
+	_, body := getCallback(t, redirectURL, url.Values{"error": {"login_required"}, "state": {material.State}})
+	r.Equal("idp_error|Ask #help|login_required", body)
+
+	_, err := a.server.Wait(context.Background())
+	r.Error(err)
+	r.Contains(err.Error(), `"login_required"`)
+}
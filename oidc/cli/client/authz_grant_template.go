@@ -0,0 +1,61 @@
+package client
+
+import (
+	"html/template"
+	"io"
+)
+
+const callbackPageTemplateText = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }}</title>
+<style>
+  body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; background: #f4f5f7; color: #1f2328; margin: 0; }
+  main { max-width: 32rem; margin: 15vh auto 0; padding: 2rem 2.5rem; background: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0, 0, 0, .15); }
+  h1 { font-size: 1.4rem; margin-top: 0; }
+  .success h1 { color: #1a7f37; }
+  .failure h1 { color: #cf222e; }
+  code { background: #f4f5f7; padding: .1rem .3rem; border-radius: 4px; }
+  .hint { color: #59636e; font-size: .9rem; }
+</style>
+</head>
+<body>
+<main class="{{ if .Success }}success{{ else }}failure{{ end }}">
+  <h1>{{ .Title }}</h1>
+  <p>{{ .Message }}</p>
+  {{- if .Error }}
+  <p>The identity provider returned <code>{{ .Error }}</code>{{ if .ErrorDescription }}: {{ .ErrorDescription }}{{ end }}</p>
+  {{- end }}
+  {{- if .Success }}
+  <p class="hint">You can close this window.</p>
+  {{- else }}
+  <p class="hint">Return to the terminal for details and try signing in again.</p>
+  {{- end }}
+</main>
+</body>
+</html>
+`
+
+var defaultCallbackPageTemplate = template.Must(template.New("callbackPage").Parse(callbackPageTemplateText))
+
+// CallbackPageData is what the page shown in the browser at the end of the
+// authorization code flow is rendered with.
+type CallbackPageData struct {
+	// Status is one of success, state_mismatch, idp_error,
+	// exchange_failed and invalid_token.
+	Status  string
+	Success bool
+	Title   string
+	Message string
+	// Error and ErrorDescription are set when the IdP redirected with an
+	// error response, e.g. access_denied.
+	Error            string
+	ErrorDescription string
+}
+
+// renderCallbackPage renders the callback page template to the given writer
+func renderCallbackPage(w io.Writer, tmpl *template.Template, data *CallbackPageData) error {
+	return tmpl.Execute(w, data)
+}
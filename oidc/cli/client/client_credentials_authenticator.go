@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// ClientAuthMethod is how a client authenticates at the token endpoint
+// (the token_endpoint_auth_method of OIDC client registration).
+type ClientAuthMethod string
+
+const (
+	// ClientSecretPost sends the client secret in the request body.
+	ClientSecretPost ClientAuthMethod = "client_secret_post"
+	// ClientSecretBasic sends the client secret with HTTP basic auth.
+	ClientSecretBasic ClientAuthMethod = "client_secret_basic"
+	// PrivateKeyJWT sends a JWT assertion signed with the client's
+	// private key (RFC 7523).
+	PrivateKeyJWT ClientAuthMethod = "private_key_jwt"
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// clientAssertionLifetime is how long a private_key_jwt assertion is valid.
+	clientAssertionLifetime = 5 * time.Minute
+)
+
+// ClientCredentialsAuthenticator implements the non-interactive OAuth 2.0
+// Client Credentials Grant, for CI jobs and other machine identities.
+type ClientCredentialsAuthenticator struct {
+	authMethod   ClientAuthMethod
+	clientSecret string
+	privateKey   *rsa.PrivateKey
+	keyID        string
+}
+
+// NewClientSecretAuthenticator authenticates with a client secret using
+// ClientSecretPost or ClientSecretBasic.
+func NewClientSecretAuthenticator(clientSecret string, authMethod ClientAuthMethod) (*ClientCredentialsAuthenticator, error) {
+	if authMethod != ClientSecretPost && authMethod != ClientSecretBasic {
+		return nil, fmt.Errorf("unsupported client secret auth method %q", authMethod)
+	}
+	if clientSecret == "" {
+		return nil, fmt.Errorf("client secret must not be empty")
+	}
+	return &ClientCredentialsAuthenticator{
+		authMethod:   authMethod,
+		clientSecret: clientSecret,
+	}, nil
+}
+
+// NewPrivateKeyJWTAuthenticator authenticates with a private_key_jwt
+// assertion signed by privateKey (e.g. loaded with
+// keypair.ParseRSAPrivateKey). keyID is sent as the kid header when set.
+func NewPrivateKeyJWTAuthenticator(privateKey *rsa.PrivateKey, keyID string) (*ClientCredentialsAuthenticator, error) {
+	if privateKey == nil {
+		return nil, fmt.Errorf("private key must not be nil")
+	}
+	return &ClientCredentialsAuthenticator{
+		authMethod: PrivateKeyJWT,
+		privateKey: privateKey,
+		keyID:      keyID,
+	}, nil
+}
+
+// WithClientCredentialsAuthenticator authenticates with the client
+// credentials grant instead of an interactive flow.
+func WithClientCredentialsAuthenticator(a *ClientCredentialsAuthenticator) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		c.authenticator = a
+		return nil
+	}
+}
+
+// clientAuth returns the credentials of a confidential client, or nil for a
+// public client.
+func (c *OIDCClient) clientAuth() *ClientCredentialsAuthenticator {
+	a, _ := c.authenticator.(*ClientCredentialsAuthenticator)
+	return a
+}
+
+// Authenticate requests a token with the client credentials grant. Only
+// scopes set with WithScopes are requested: most IdPs reject the
+// DefaultScopes openid and offline_access for this grant.
+func (c *ClientCredentialsAuthenticator) Authenticate(ctx context.Context, client *OIDCClient) (*Token, error) {
+	config := &clientcredentials.Config{
+		ClientID:     client.ClientID,
+		ClientSecret: c.clientSecret,
+		TokenURL:     client.Endpoint.TokenURL,
+		AuthStyle:    oauth2.AuthStyleInParams,
+	}
+	if client.scopesSet {
+		config.Scopes = client.Scopes
+	}
+
+	switch c.authMethod {
+	case ClientSecretBasic:
+		config.AuthStyle = oauth2.AuthStyleInHeader
+	case PrivateKeyJWT:
+		assertion, err := c.clientAssertion(client.ClientID, client.Endpoint.TokenURL)
+		if err != nil {
+			return nil, err
+		}
+		config.EndpointParams = url.Values{
+			"client_assertion_type": {clientAssertionType},
+			"client_assertion":      {assertion},
+		}
+	}
+
+	token, err := config.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("requesting client credentials token: %w", idpRequestError(err))
+	}
+
+	// an ID token is only returned if the IdP issues one for this grant
+	claims, _, verifiedIDToken, err := client.ParseAsIDToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("extracting id token: %w", err)
+	}
+	if claims == nil {
+		claims = &Claims{}
+	}
+
+	return &Token{
+		IDToken: verifiedIDToken,
+		Claims:  *claims,
+		Token:   token,
+	}, nil
+}
+
+// addClientAuth authenticates a request to endpoint (e.g. a token exchange
+// or a revocation), adding the client's credentials to form. It returns the
+// HTTP basic auth credentials to send, if any.
+func (c *ClientCredentialsAuthenticator) addClientAuth(form url.Values, clientID, endpoint string) (user, password string, err error) {
+	switch c.authMethod {
+	case ClientSecretBasic:
+		// RFC 6749 section 2.3.1: both are form-encoded before basic auth
+		form.Del("client_id")
+		return url.QueryEscape(clientID), url.QueryEscape(c.clientSecret), nil
+	case PrivateKeyJWT:
+		assertion, err := c.clientAssertion(clientID, endpoint)
+		if err != nil {
+			return "", "", err
+		}
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	default:
+		form.Set("client_secret", c.clientSecret)
+	}
+	return "", "", nil
+}
+
+// newClientRequest returns a form POST to an endpoint of the authorization
+// server (token, introspection or revocation) on behalf of clientID. It is
+// authenticated with auth's credentials when set, otherwise only client_id
+// identifies the client.
+func newClientRequest(
+	ctx context.Context,
+	endpoint string,
+	clientID string,
+	auth *ClientCredentialsAuthenticator,
+	form url.Values,
+) (*http.Request, error) {
+	form.Set("client_id", clientID)
+
+	var user, password string
+	if auth != nil {
+		var err error
+		user, password, err = auth.addClientAuth(form, clientID, endpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	return req, nil
+}
+
+// clientAssertion returns a signed private_key_jwt assertion for tokenURL.
+func (c *ClientCredentialsAuthenticator) clientAssertion(clientID, tokenURL string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    clientID,
+		Subject:   clientID,
+		Audience:  jwt.ClaimStrings{tokenURL},
+		ID:        uuid.NewString(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(clientAssertionLifetime)),
+	})
+	if c.keyID != "" {
+		token.Header["kid"] = c.keyID
+	}
+
+	assertion, err := token.SignedString(c.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("signing client assertion: %w", err)
+	}
+	return assertion, nil
+}
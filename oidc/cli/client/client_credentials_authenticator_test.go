@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func authenticateClientCredentials(t *testing.T, idp *fakeIdP, a *ClientCredentialsAuthenticator, opts ...OIDCClientOption) *Token {
+	t.Helper()
+	ctx := context.Background()
+	opts = append([]OIDCClientOption{
+		WithDiscoveryCache(NewDiscoveryCache("", 0)),
+		WithClientCredentialsAuthenticator(a),
+	}, opts...)
+	c, err := NewOIDCClient(ctx, "machine-client", idp.URL, opts...)
+	require.NoError(t, err)
+
+	// a token without a refresh token falls back to the authenticator
+	token, err := c.RefreshToken(ctx, &Token{Token: &oauth2.Token{}})
+	require.NoError(t, err)
+	return token
+}
+
+func TestClientSecretPost(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	a, err := NewClientSecretAuthenticator("s3cret", ClientSecretPost)
+	r.NoError(err)
+	token := authenticateClientCredentials(t, idp, a, WithScopes([]string{"api:read"}))
+	r.Equal("machine-token", token.AccessToken)
+
+	form := idp.lastTokenRequest(t).PostForm
+	r.Equal("client_credentials", form.Get("grant_type"))
+	r.Equal("machine-client", form.Get("client_id"))
+	r.Equal("s3cret", form.Get("client_secret"))
+	r.Equal("api:read", form.Get("scope"))
+}
+
+func TestClientCredentialsDefaultScopes(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	a, err := NewClientSecretAuthenticator("s3cret", ClientSecretPost)
+	r.NoError(err)
+	authenticateClientCredentials(t, idp, a)
+
+	// DefaultScopes (openid, offline_access, ...) are not requested
+	r.NotContains(idp.lastTokenRequest(t).PostForm, "scope")
+}
+
+func TestClientSecretBasic(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	a, err := NewClientSecretAuthenticator("s3cret", ClientSecretBasic)
+	r.NoError(err)
+	token := authenticateClientCredentials(t, idp, a)
+	r.Equal("machine-token", token.AccessToken)
+
+	req := idp.lastTokenRequest(t)
+	user, pass, ok := req.BasicAuth()
+	r.True(ok)
+	r.Equal("machine-client", user)
+	r.Equal("s3cret", pass)
+	r.Empty(req.PostForm.Get("client_secret"))
+
+	_, err = NewClientSecretAuthenticator("s3cret", PrivateKeyJWT)
+	r.Error(err)
+	_, err = NewClientSecretAuthenticator("", ClientSecretPost)
+	r.Error(err)
+}
+
+func TestPrivateKeyJWT(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	r.NoError(err)
+
+	a, err := NewPrivateKeyJWTAuthenticator(key, "key-1")
+	r.NoError(err)
+	token := authenticateClientCredentials(t, idp, a)
+	r.Equal("machine-token", token.AccessToken)
+
+	form := idp.lastTokenRequest(t).PostForm
+	r.Equal(clientAssertionType, form.Get("client_assertion_type"))
+	r.Empty(form.Get("client_secret"))
+
+	claims := &jwt.RegisteredClaims{}
+	parsed, err := jwt.ParseWithClaims(form.Get("client_assertion"), claims, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	r.NoError(err)
+	r.Equal("key-1", parsed.Header["kid"])
+	r.Equal("machine-client", claims.Issuer)
+	r.Equal("machine-client", claims.Subject)
+	r.True(claims.VerifyAudience(idp.URL+"/token", true))
+	r.NotEmpty(claims.ID)
+}
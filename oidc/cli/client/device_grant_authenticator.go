@@ -3,10 +3,6 @@ package client
 import (
 	"context"
 	"fmt"
-	"os"
-	"time"
-
-	"golang.org/x/oauth2"
 )
 
 // DeviceGrantAuthenticator implements the OAuth 2.0 Device Authorization Grant flow
@@ -20,45 +16,40 @@ func NewDeviceGrantAuthenticator() *DeviceGrantAuthenticator {
 
 // Authenticate initiates the device authorization flow and waits for user authentication
 func (c *DeviceGrantAuthenticator) Authenticate(ctx context.Context, client *OIDCClient) (*Token, error) {
-	response, err := client.DeviceAuth(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("requesting device code: %w", err)
+	if client.Endpoint.DeviceAuthURL == "" {
+		return nil, fmt.Errorf("no device_authorization_endpoint in discovery document: %w", ErrAuthenticatorUnavailable)
 	}
 
-	err = c.displayUserCode(response)
+	response, err := client.DeviceAuth(ctx, client.requirement.authCodeOptions()...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("requesting device code: %w", idpRequestError(err))
 	}
 
+	client.prompter.DeviceCode(ctx, &DeviceCode{
+		VerificationURI:         response.VerificationURI,
+		VerificationURIComplete: response.VerificationURIComplete,
+		UserCode:                response.UserCode,
+		Expiry:                  response.Expiry,
+	})
+
 	token, err := client.DeviceAccessToken(ctx, response)
 	if err != nil {
-		return nil, fmt.Errorf("requesting access token: %w", err)
+		return nil, fmt.Errorf("requesting access token: %w", deviceAuthorizationError(err))
 	}
 
-	fmt.Fprintf(os.Stderr, "\n✓ Successfully authenticated!\n")
-
 	claims, _, verifiedIDToken, err := client.ParseAsIDToken(ctx, token)
 	if err != nil {
 		return nil, fmt.Errorf("extracting id token: %w", err)
 	}
+	if claims == nil {
+		claims = &Claims{}
+	}
 
-	return &Token{
+	authenticated := &Token{
 		IDToken: verifiedIDToken,
 		Claims:  *claims,
 		Token:   token,
-	}, nil
-}
-
-// displayUserCode displays the user code and verification URL to the user
-func (c *DeviceGrantAuthenticator) displayUserCode(deviceAuth *oauth2.DeviceAuthResponse) error {
-	data := &deviceAuthTemplateData{
-		VerificationURI:  deviceAuth.VerificationURI,
-		UserCode:         deviceAuth.UserCode,
-		ExpiresInMinutes: int(time.Until(deviceAuth.Expiry).Minutes()),
-	}
-	err := renderDeviceAuthTemplate(os.Stderr, data)
-	if err != nil {
-		return fmt.Errorf("rendering device auth template: %w", err)
 	}
-	return nil
+	client.prompter.Authenticated(ctx, authenticated)
+	return authenticated, nil
 }
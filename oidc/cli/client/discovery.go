@@ -0,0 +1,257 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+)
+
+// DefaultDiscoveryMaxAge is the longest a discovery document is cached,
+// and how long it is cached when the response has no cache headers.
+const DefaultDiscoveryMaxAge = 24 * time.Hour
+
+// ProviderMetadata is the OIDC discovery document
+// (/.well-known/openid-configuration) of an issuer.
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	RevocationEndpoint                string   `json:"revocation_endpoint,omitempty"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported,omitempty"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
+}
+
+// discoveryCacheEntry is the on-disk format of a cached discovery document.
+type discoveryCacheEntry struct {
+	ExpiresAt time.Time         `json:"expires_at"`
+	Metadata  *ProviderMetadata `json:"metadata"`
+}
+
+// DiscoveryCache caches OIDC discovery documents in memory and, when dir
+// is set, on disk so that they are shared across processes. Cache
+// lifetimes honor the response's Cache-Control max-age or Expires header,
+// capped at maxAge. If a refetch fails, a stale cached document is used.
+type DiscoveryCache struct {
+	dir    string
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*discoveryCacheEntry
+}
+
+// defaultDiscoveryCache is the process-wide, memory-only cache used when no
+// DiscoveryCache is configured.
+var defaultDiscoveryCache = NewDiscoveryCache("", 0)
+
+// NewDiscoveryCache returns a discovery cache persisting documents in dir.
+// An empty dir caches in memory only. maxAge <= 0 uses DefaultDiscoveryMaxAge.
+func NewDiscoveryCache(dir string, maxAge time.Duration) *DiscoveryCache {
+	if maxAge <= 0 {
+		maxAge = DefaultDiscoveryMaxAge
+	}
+	return &DiscoveryCache{
+		dir:     dir,
+		maxAge:  maxAge,
+		entries: map[string]*discoveryCacheEntry{},
+	}
+}
+
+// Get returns the discovery document for issuerURL, fetching it only if
+// no fresh copy is cached.
+func (d *DiscoveryCache) Get(ctx context.Context, issuerURL string) (*ProviderMetadata, error) {
+	log := logging.FromContext(ctx)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry := d.entries[issuerURL]
+	if entry == nil {
+		entry = d.readFile(log, issuerURL)
+	}
+	if entry != nil && time.Now().Before(entry.ExpiresAt) {
+		d.entries[issuerURL] = entry
+		log.Debug("DiscoveryCache.Get: using cached discovery document",
+			"issuer_url", issuerURL,
+			"expires_at", entry.ExpiresAt,
+		)
+		return entry.Metadata, nil
+	}
+
+	fetched, ttl, err := d.fetch(ctx, issuerURL)
+	if err != nil {
+		if entry != nil {
+			log.Warn("DiscoveryCache.Get: fetching discovery document failed, using stale copy",
+				"issuer_url", issuerURL,
+				"expired_at", entry.ExpiresAt,
+				"error", err,
+			)
+			return entry.Metadata, nil
+		}
+		return nil, err
+	}
+
+	entry = &discoveryCacheEntry{
+		ExpiresAt: time.Now().Add(ttl),
+		Metadata:  fetched,
+	}
+	if ttl > 0 {
+		d.entries[issuerURL] = entry
+		d.writeFile(log, issuerURL, entry)
+	}
+	return fetched, nil
+}
+
+func (d *DiscoveryCache) fetch(ctx context.Context, issuerURL string) (*ProviderMetadata, time.Duration, error) {
+	wellKnown := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating discovery request: %w", err)
+	}
+
+	resp, err := httpClientFromContext(ctx).Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching discovery document: %w", idpRequestError(err))
+	}
+	defer resp.Body.Close()
+
+	if isGatewayFailure(resp.StatusCode) {
+		return nil, 0, fmt.Errorf("%w: discovery endpoint returned %s", ErrIdPUnreachable, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("discovery endpoint returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading discovery document: %w", err)
+	}
+
+	metadata := &ProviderMetadata{}
+	err = json.Unmarshal(body, metadata)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decoding discovery document: %w", err)
+	}
+	return metadata, d.cacheTTL(resp.Header), nil
+}
+
+// cacheTTL derives how long a response may be cached from its headers,
+// capped at maxAge. no-store and no-cache responses are not cached.
+func (d *DiscoveryCache) cacheTTL(header http.Header) time.Duration {
+	ttl := d.maxAge
+
+	if cc := header.Get("Cache-Control"); cc != "" {
+		for _, directive := range strings.Split(cc, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store" || directive == "no-cache":
+				return 0
+			case strings.HasPrefix(directive, "max-age="):
+				secs, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+				if err == nil {
+					return min(time.Duration(secs)*time.Second, d.maxAge)
+				}
+			}
+		}
+	}
+
+	if exp := header.Get("Expires"); exp != "" {
+		expires, err := http.ParseTime(exp)
+		if err != nil {
+			// invalid Expires means already expired (RFC 9111)
+			return 0
+		}
+		return max(min(time.Until(expires), d.maxAge), 0)
+	}
+	return ttl
+}
+
+func (d *DiscoveryCache) path(issuerURL string) string {
+	h := sha256.Sum256([]byte(issuerURL))
+	return filepath.Join(d.dir, fmt.Sprintf("discovery-%s.json", hex.EncodeToString(h[:])))
+}
+
+// readFile returns the on-disk entry for issuerURL, or nil if there is
+// none. Unreadable entries are ignored.
+func (d *DiscoveryCache) readFile(log *slog.Logger, issuerURL string) *discoveryCacheEntry {
+	if d.dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(d.path(issuerURL))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Debug("DiscoveryCache: failed to read cache file", "error", err)
+		}
+		return nil
+	}
+
+	entry := &discoveryCacheEntry{}
+	err = json.Unmarshal(data, entry)
+	if err != nil || entry.Metadata == nil {
+		log.Debug("DiscoveryCache: ignoring invalid cache file", "path", d.path(issuerURL), "error", err)
+		return nil
+	}
+	return entry
+}
+
+// writeFile persists entry atomically. Failures are logged but not
+// propagated; the document is still cached in memory.
+func (d *DiscoveryCache) writeFile(log *slog.Logger, issuerURL string, entry *discoveryCacheEntry) {
+	if d.dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Warn("DiscoveryCache: failed to marshal cache entry", "error", err)
+		return
+	}
+
+	err = os.MkdirAll(d.dir, 0700)
+	if err != nil {
+		log.Warn("DiscoveryCache: failed to create cache dir", "error", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(d.dir, ".oidc-discovery-*.tmp")
+	if err != nil {
+		log.Warn("DiscoveryCache: failed to create temp file", "error", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path(issuerURL))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Warn("DiscoveryCache: failed to write cache file", "error", err)
+	}
+}
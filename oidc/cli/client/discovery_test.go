@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newDiscoveryServer serves a discovery document for its own URL and
+// counts the requests made to it. cacheControl is sent as Cache-Control
+// when non-empty.
+func newDiscoveryServer(t *testing.T, cacheControl string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if req.URL.Path != "/.well-known/openid-configuration" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+			"issuer":                                srv.URL,
+			"authorization_endpoint":                srv.URL + "/authorize",
+			"token_endpoint":                        srv.URL + "/token",
+			"device_authorization_endpoint":         srv.URL + "/device",
+			"jwks_uri":                              srv.URL + "/keys",
+			"introspection_endpoint":                srv.URL + "/introspect",
+			"revocation_endpoint":                   srv.URL + "/revoke",
+			"id_token_signing_alg_values_supported": []string{"RS256", "ES256"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestDiscoveryCachePersistsOnDisk(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	srv, requests := newDiscoveryServer(t, "")
+
+	metadata, err := NewDiscoveryCache(dir, 0).Get(ctx, srv.URL)
+	r.NoError(err)
+	r.Equal(srv.URL+"/token", metadata.TokenEndpoint)
+	r.Equal(srv.URL+"/revoke", metadata.RevocationEndpoint)
+	r.Equal([]string{"RS256", "ES256"}, metadata.IDTokenSigningAlgValuesSupported)
+	r.Equal(int32(1), requests.Load())
+
+	// a new cache (e.g. another process) reads the document from disk
+	metadata, err = NewDiscoveryCache(dir, 0).Get(ctx, srv.URL)
+	r.NoError(err)
+	r.Equal(srv.URL+"/token", metadata.TokenEndpoint)
+	r.Equal(int32(1), requests.Load())
+}
+
+func TestDiscoveryCacheNoStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	srv, requests := newDiscoveryServer(t, "no-store")
+
+	d := NewDiscoveryCache(t.TempDir(), 0)
+	_, err := d.Get(ctx, srv.URL)
+	r.NoError(err)
+	_, err = d.Get(ctx, srv.URL)
+	r.NoError(err)
+	r.Equal(int32(2), requests.Load())
+}
+
+func TestDiscoveryCacheStaleOnError(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	srv, _ := newDiscoveryServer(t, "")
+
+	d := NewDiscoveryCache(dir, 0)
+	_, err := d.Get(ctx, srv.URL)
+	r.NoError(err)
+
+	d.entries[srv.URL].ExpiresAt = time.Now().Add(-time.Minute)
+	srv.Close()
+
+	metadata, err := d.Get(ctx, srv.URL)
+	r.NoError(err)
+	r.Equal(srv.URL+"/token", metadata.TokenEndpoint)
+}
+
+func TestDiscoveryCacheTTL(t *testing.T) {
+	r := require.New(t)
+	d := NewDiscoveryCache("", time.Hour)
+
+	r.Equal(time.Hour, d.cacheTTL(http.Header{}))
+	r.Equal(5*time.Minute, d.cacheTTL(http.Header{"Cache-Control": {"public, max-age=300"}}))
+	r.Equal(time.Hour, d.cacheTTL(http.Header{"Cache-Control": {"max-age=86400"}}))
+	r.Equal(time.Duration(0), d.cacheTTL(http.Header{"Cache-Control": {"no-cache"}}))
+	r.Equal(time.Duration(0), d.cacheTTL(http.Header{"Expires": {"0"}}))
+
+	ttl := d.cacheTTL(http.Header{"Expires": {time.Now().Add(10 * time.Minute).UTC().Format(http.TimeFormat)}})
+	r.InDelta(10*time.Minute, ttl, float64(2*time.Second))
+}
+
+func TestNewOIDCClientUsesDiscoveryCache(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	srv, requests := newDiscoveryServer(t, "")
+
+	c, err := NewOIDCClient(ctx, "client-id", srv.URL, WithDiscoveryCache(NewDiscoveryCache(dir, 0)))
+	r.NoError(err)
+	r.Equal(srv.URL+"/token", c.Endpoint.TokenURL)
+	r.Equal(srv.URL+"/device", c.Endpoint.DeviceAuthURL)
+	r.Equal(srv.URL+"/introspect", c.Metadata().IntrospectionEndpoint)
+	r.Equal(int32(1), requests.Load())
+
+	_, err = NewOIDCClient(ctx, "client-id", srv.URL, WithDiscoveryCache(NewDiscoveryCache(dir, 0)))
+	r.NoError(err)
+	r.Equal(int32(1), requests.Load(), "warm client creation should not hit the network")
+}
+
+func TestNewOIDCClientIssuerMismatch(t *testing.T) {
+	r := require.New(t)
+	srv, _ := newDiscoveryServer(t, "")
+
+	_, err := NewOIDCClient(context.Background(), "client-id", srv.URL+"/", WithDiscoveryCache(NewDiscoveryCache("", 0)))
+	r.Error(err)
+	r.Contains(err.Error(), "issuer did not match")
+}
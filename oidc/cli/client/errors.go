@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+// Errors of the token lifecycle, to be checked with errors.Is. See also
+// AuthorizationError, ErrAuthenticatorUnavailable and
+// ErrAuthenticationRequirementNotMet.
+var (
+	// ErrRefreshTokenRevoked means the IdP rejected the refresh token
+	// (invalid_grant): it expired, was revoked or was already rotated.
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked or expired")
+	// ErrInteractiveRequired means the user has to log in again, but no
+	// interactive flow could run.
+	ErrInteractiveRequired = errors.New("interactive login required")
+	// ErrIdPUnreachable means a request to the IdP failed at the network
+	// level, or a gateway in front of it was unavailable.
+	ErrIdPUnreachable = errors.New("identity provider unreachable")
+)
+
+// idpRequestError wraps err with ErrIdPUnreachable when a request to the
+// IdP failed to reach it, keeping other errors as is.
+func idpRequestError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		if retrieveErr.Response != nil && isGatewayFailure(retrieveErr.Response.StatusCode) {
+			return fmt.Errorf("%w: %w", ErrIdPUnreachable, err)
+		}
+		return err
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%w: %w", ErrIdPUnreachable, err)
+	}
+	return err
+}
+
+// isGatewayFailure reports whether an HTTP status means the IdP could not
+// be reached behind its load balancer or proxy.
+func isGatewayFailure(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
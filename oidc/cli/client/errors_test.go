@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestIdPUnreachable(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	// nothing listens here
+	_, err := NewOIDCClient(ctx, "client-id", "http://127.0.0.1:1", WithDiscoveryCache(NewDiscoveryCache("", 0)))
+	r.ErrorIs(err, ErrIdPUnreachable)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	_, err = NewOIDCClient(ctx, "client-id", srv.URL, WithDiscoveryCache(NewDiscoveryCache("", 0)))
+	r.ErrorIs(err, ErrIdPUnreachable)
+
+	r.NotErrorIs(idpRequestError(&oauth2.RetrieveError{ErrorCode: "invalid_request"}), ErrIdPUnreachable)
+	r.NotErrorIs(idpRequestError(fmt.Errorf("parsing: %w", context.Canceled)), ErrIdPUnreachable)
+}
+
+func TestRefreshTokenRevokedWithoutInteractiveFlow(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	unavailable := &fakeAuthenticator{err: fmt.Errorf("no browser: %w", ErrAuthenticatorUnavailable)}
+	c := idp.client(t, withFakeAuthenticator(unavailable))
+
+	// the fake IdP answers any refresh with invalid_grant
+	_, err := c.RefreshToken(context.Background(), &Token{Token: &oauth2.Token{RefreshToken: "revoked"}})
+	r.ErrorIs(err, ErrInteractiveRequired)
+	r.ErrorIs(err, ErrRefreshTokenRevoked)
+	r.ErrorIs(err, ErrAuthenticatorUnavailable)
+	r.NotErrorIs(err, ErrIdPUnreachable)
+}
+
+func TestRefreshTokenNonInteractive(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	ctx := context.Background()
+
+	interactive := &fakeAuthenticator{token: &Token{Token: &oauth2.Token{AccessToken: "interactive"}}}
+	c := idp.client(t, withFakeAuthenticator(interactive), WithNonInteractive())
+	_, err := c.RefreshToken(ctx, &Token{Token: &oauth2.Token{RefreshToken: "revoked"}})
+	r.ErrorIs(err, ErrInteractiveRequired)
+	r.ErrorIs(err, ErrRefreshTokenRevoked)
+	r.Equal(0, interactive.calls)
+
+	t.Setenv(NonInteractiveEnvVar, "true")
+	c = idp.client(t, withFakeAuthenticator(interactive))
+	_, err = c.RefreshToken(ctx, &Token{Token: &oauth2.Token{}})
+	r.ErrorIs(err, ErrInteractiveRequired)
+	r.Equal(0, interactive.calls)
+
+	t.Setenv(NonInteractiveEnvVar, "not-a-bool")
+	c = idp.client(t, withFakeAuthenticator(interactive))
+	token, err := c.RefreshToken(ctx, &Token{Token: &oauth2.Token{}})
+	r.NoError(err)
+	r.Equal("interactive", token.AccessToken)
+}
+
+func TestRefreshTokenNonInteractiveNeverAuthenticates(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	interactive := &fakeAuthenticator{token: &Token{Token: &oauth2.Token{AccessToken: "interactive"}}}
+	c := idp.client(t, withFakeAuthenticator(interactive))
+	_, err := c.RefreshTokenNonInteractive(context.Background(), &Token{Token: &oauth2.Token{RefreshToken: "revoked"}})
+	r.ErrorIs(err, ErrRefreshTokenRevoked)
+	r.Equal(0, interactive.calls)
+}
+
+func TestClientCredentialsRunsWhenNonInteractive(t *testing.T) {
+	r := require.New(t)
+
+	a, err := NewClientSecretAuthenticator("secret", ClientSecretPost)
+	r.NoError(err)
+	r.False(isInteractive(a))
+	r.True(isInteractive(NewDeviceGrantAuthenticator()))
+}
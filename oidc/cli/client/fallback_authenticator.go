@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAuthenticatorUnavailable is wrapped by authenticator errors meaning
+// the flow cannot run in this environment (no free callback port, no
+// browser, no device authorization endpoint), as opposed to the user or
+// IdP rejecting the login. Only these errors fall through to the next
+// authenticator of WithFallbackAuthenticators.
+var ErrAuthenticatorUnavailable = errors.New("authenticator unavailable")
+
+// fallbackAuthenticator tries each authenticator in turn until one is
+// available.
+type fallbackAuthenticator struct {
+	authenticators []authenticator
+}
+
+// WithFallbackAuthenticators tries the authenticators configured by each
+// option (e.g. WithAuthzGrantAuthenticator, WithDeviceGrantAuthenticator)
+// in order, moving on to the next one when a flow is unavailable.
+func WithFallbackAuthenticators(options ...OIDCClientOption) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		if len(options) == 0 {
+			return fmt.Errorf("no fallback authenticators configured")
+		}
+
+		fallback := &fallbackAuthenticator{}
+		for i, option := range options {
+			c.authenticator = nil
+			err := option(ctx, c)
+			if err != nil {
+				return err
+			}
+			if c.authenticator == nil {
+				return fmt.Errorf("fallback option %d did not configure an authenticator", i)
+			}
+			fallback.authenticators = append(fallback.authenticators, c.authenticator)
+		}
+
+		c.authenticator = fallback
+		return nil
+	}
+}
+
+// Authenticate runs the first available authenticator.
+func (f *fallbackAuthenticator) Authenticate(ctx context.Context, client *OIDCClient) (*Token, error) {
+	var errs []error
+	for _, a := range f.authenticators {
+		token, err := a.Authenticate(ctx, client)
+		if err == nil {
+			return token, nil
+		}
+		if !errors.Is(err, ErrAuthenticatorUnavailable) {
+			return nil, err
+		}
+
+		client.log.Warn("fallbackAuthenticator.Authenticate: authenticator unavailable, trying next",
+			"authenticator", fmt.Sprintf("%T", a),
+			"error", err,
+		)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("all authenticators failed: %w", errors.Join(errs...))
+}
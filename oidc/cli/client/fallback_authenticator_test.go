@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+type fakeAuthenticator struct {
+	calls int
+	token *Token
+	err   error
+}
+
+func (f *fakeAuthenticator) Authenticate(context.Context, *OIDCClient) (*Token, error) {
+	f.calls++
+	return f.token, f.err
+}
+
+func withFakeAuthenticator(a *fakeAuthenticator) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		c.authenticator = a
+		return nil
+	}
+}
+
+func TestFallbackAuthenticator(t *testing.T) {
+	r := require.New(t)
+	srv, _ := newDiscoveryServer(t, "")
+
+	unavailable := &fakeAuthenticator{err: fmt.Errorf("no browser: %w", ErrAuthenticatorUnavailable)}
+	working := &fakeAuthenticator{token: &Token{Token: &oauth2.Token{AccessToken: "device"}}}
+	unused := &fakeAuthenticator{}
+
+	c, err := NewOIDCClient(context.Background(), "client-id", srv.URL,
+		WithDiscoveryCache(NewDiscoveryCache("", 0)),
+		WithFallbackAuthenticators(
+			withFakeAuthenticator(unavailable),
+			withFakeAuthenticator(working),
+			withFakeAuthenticator(unused),
+		),
+	)
+	r.NoError(err)
+
+	token, err := c.authenticator.Authenticate(context.Background(), c)
+	r.NoError(err)
+	r.Equal("device", token.AccessToken)
+	r.Equal(1, unavailable.calls)
+	r.Equal(1, working.calls)
+	r.Equal(0, unused.calls)
+}
+
+func TestFallbackAuthenticatorStopsOnLoginFailure(t *testing.T) {
+	r := require.New(t)
+	denied := errors.New("access denied")
+	first := &fakeAuthenticator{err: denied}
+	second := &fakeAuthenticator{}
+
+	f := &fallbackAuthenticator{authenticators: []authenticator{first, second}}
+	_, err := f.Authenticate(context.Background(), &OIDCClient{})
+	r.ErrorIs(err, denied)
+	r.Equal(0, second.calls)
+}
+
+func TestFallbackAuthenticatorAllUnavailable(t *testing.T) {
+	r := require.New(t)
+	srv, _ := newDiscoveryServer(t, "")
+	ctx := context.Background()
+
+	c, err := NewOIDCClient(ctx, "client-id", srv.URL, WithDiscoveryCache(NewDiscoveryCache("", 0)))
+	r.NoError(err)
+	c.Endpoint.DeviceAuthURL = ""
+
+	f := &fallbackAuthenticator{authenticators: []authenticator{
+		&fakeAuthenticator{err: fmt.Errorf("binding: %w", ErrAuthenticatorUnavailable)},
+		NewDeviceGrantAuthenticator(),
+	}}
+	_, err = f.Authenticate(ctx, c)
+	r.ErrorIs(err, ErrAuthenticatorUnavailable)
+	r.Contains(err.Error(), "device_authorization_endpoint")
+}
+
+func TestWithFallbackAuthenticatorsValidation(t *testing.T) {
+	r := require.New(t)
+	srv, _ := newDiscoveryServer(t, "")
+	ctx := context.Background()
+
+	_, err := NewOIDCClient(ctx, "client-id", srv.URL, WithFallbackAuthenticators())
+	r.Error(err)
+
+	_, err = NewOIDCClient(ctx, "client-id", srv.URL, WithFallbackAuthenticators(WithScopes([]string{"openid"})))
+	r.Error(err)
+	r.Contains(err.Error(), "did not configure an authenticator")
+}
+
+func TestAuthzGrantBindFailureIsUnavailable(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "localhost:0")
+	r.NoError(err)
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	a, err := NewAuthorizationGrantAuthenticator(ctx, &AuthorizationGrantConfig{
+		ServerConfig: &ServerConfig{FromPort: port, ToPort: port, Timeout: time.Second},
+	}, &oauth2.Config{})
+	r.NoError(err)
+
+	_, err = a.Authenticate(ctx, &OIDCClient{Config: &oauth2.Config{}})
+	r.ErrorIs(err, ErrAuthenticatorUnavailable)
+}
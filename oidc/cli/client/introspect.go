@@ -10,8 +10,111 @@ import (
 	"time"
 )
 
+// IntrospectionResult is an OAuth 2.0 token introspection response (RFC 7662).
+type IntrospectionResult struct {
+	Active    bool
+	Scope     string
+	ClientID  string
+	Username  string
+	TokenType string
+	Expiry    time.Time
+	IssuedAt  time.Time
+	NotBefore time.Time
+	Subject   string
+	Audience  Audience
+	Issuer    string
+	JWTID     string
+	// Extra holds any claims not covered by the fields above, such as
+	// IdP-specific custom claims.
+	Extra map[string]interface{}
+}
+
+// introspectionResponse is the wire format of an introspection response.
+type introspectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope"`
+	ClientID  string   `json:"client_id"`
+	Username  string   `json:"username"`
+	TokenType string   `json:"token_type"`
+	Exp       int64    `json:"exp"`
+	Iat       int64    `json:"iat"`
+	Nbf       int64    `json:"nbf"`
+	Sub       string   `json:"sub"`
+	Aud       Audience `json:"aud"`
+	Iss       string   `json:"iss"`
+	Jti       string   `json:"jti"`
+}
+
+var introspectionFields = []string{
+	"active", "scope", "client_id", "username", "token_type",
+	"exp", "iat", "nbf", "sub", "aud", "iss", "jti",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *IntrospectionResult) UnmarshalJSON(data []byte) error {
+	var resp introspectionResponse
+	err := json.Unmarshal(data, &resp)
+	if err != nil {
+		return err
+	}
+
+	var extra map[string]interface{}
+	err = json.Unmarshal(data, &extra)
+	if err != nil {
+		return err
+	}
+	for _, field := range introspectionFields {
+		delete(extra, field)
+	}
+
+	*r = IntrospectionResult{
+		Active:    resp.Active,
+		Scope:     resp.Scope,
+		ClientID:  resp.ClientID,
+		Username:  resp.Username,
+		TokenType: resp.TokenType,
+		Expiry:    unixTime(resp.Exp),
+		IssuedAt:  unixTime(resp.Iat),
+		NotBefore: unixTime(resp.Nbf),
+		Subject:   resp.Sub,
+		Audience:  resp.Aud,
+		Issuer:    resp.Iss,
+		JWTID:     resp.Jti,
+		Extra:     extra,
+	}
+	return nil
+}
+
+// Scopes returns the space-separated Scope as a slice.
+func (r *IntrospectionResult) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+// unixTime converts a NumericDate to a time, mapping 0 (absent) to the zero time.
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+// Introspect discovers the issuer's introspection endpoint and returns the
+// full introspection result for token. tokenTypeHint is optional, e.g.
+// "refresh_token" or "access_token". An inactive token is not an error;
+// check IntrospectionResult.Active. It uses the default discovery cache
+// and HTTP client; use OIDCClient.Introspect to honor WithHTTPClient and
+// WithDiscoveryCache.
+func Introspect(ctx context.Context, clientID, issuerURL, token, tokenTypeHint string) (*IntrospectionResult, error) {
+	introspectURL, err := discoverIntrospectionEndpoint(ctx, issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("discovering introspection endpoint: %w", err)
+	}
+	return introspect(ctx, introspectURL, clientID, nil, token, tokenTypeHint)
+}
+
 // LookupRefreshExpiry discovers the issuer's introspection endpoint and
-// returns the expiry time for the given refresh token.
+// returns the expiry time for the given refresh token. Like Introspect, it
+// ignores the OIDCClient options; see OIDCClient.LookupRefreshExpiry.
 func LookupRefreshExpiry(ctx context.Context, clientID, issuerURL, refreshToken string) (time.Time, error) {
 	introspectURL, err := discoverIntrospectionEndpoint(ctx, issuerURL)
 	if err != nil {
@@ -20,82 +123,116 @@ func LookupRefreshExpiry(ctx context.Context, clientID, issuerURL, refreshToken
 	return introspectTokenExpiry(ctx, introspectURL, clientID, refreshToken)
 }
 
-// discoverIntrospectionEndpoint fetches the OIDC discovery document and
-// returns the introspection_endpoint URL.
-func discoverIntrospectionEndpoint(ctx context.Context, issuerURL string) (string, error) {
-	wellKnown := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+// Introspect returns the full introspection result for token from the
+// issuer's introspection endpoint, through the client's HTTP client.
+// tokenTypeHint is optional. An inactive token is not an error; check
+// IntrospectionResult.Active.
+func (c *OIDCClient) Introspect(ctx context.Context, token, tokenTypeHint string) (*IntrospectionResult, error) {
+	if c.metadata.IntrospectionEndpoint == "" {
+		return nil, fmt.Errorf("no introspection_endpoint in discovery document")
+	}
+	return introspect(c.clientContext(ctx), c.metadata.IntrospectionEndpoint, c.ClientID, c.clientAuth(), token, tokenTypeHint)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+// LookupRefreshExpiry returns the expiry time for the given refresh token
+// from the issuer's introspection endpoint, through the client's HTTP
+// client.
+func (c *OIDCClient) LookupRefreshExpiry(ctx context.Context, refreshToken string) (time.Time, error) {
+	result, err := c.Introspect(ctx, refreshToken, tokenTypeHintRefreshToken)
 	if err != nil {
-		return "", fmt.Errorf("creating discovery request: %w", err)
+		return time.Time{}, err
 	}
+	return refreshTokenExpiry(result)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// discoverIntrospectionEndpoint looks up the OIDC discovery document and
+// returns the introspection_endpoint URL.
+func discoverIntrospectionEndpoint(ctx context.Context, issuerURL string) (string, error) {
+	doc, err := defaultDiscoveryCache.Get(ctx, issuerURL)
 	if err != nil {
-		return "", fmt.Errorf("fetching discovery document: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("discovery endpoint returned %s", resp.Status)
+	if doc.IntrospectionEndpoint == "" {
+		return "", fmt.Errorf("no introspection_endpoint in discovery document")
 	}
 
-	var doc struct {
-		IntrospectionEndpoint string `json:"introspection_endpoint"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&doc)
+	return doc.IntrospectionEndpoint, nil
+}
+
+// discoverRevocationEndpoint looks up the OIDC discovery document and
+// returns the revocation_endpoint URL.
+func discoverRevocationEndpoint(ctx context.Context, issuerURL string) (string, error) {
+	doc, err := defaultDiscoveryCache.Get(ctx, issuerURL)
 	if err != nil {
-		return "", fmt.Errorf("decoding discovery document: %w", err)
+		return "", err
 	}
 
-	if doc.IntrospectionEndpoint == "" {
-		return "", fmt.Errorf("no introspection_endpoint in discovery document")
+	if doc.RevocationEndpoint == "" {
+		return "", fmt.Errorf("no revocation_endpoint in discovery document")
 	}
 
-	return doc.IntrospectionEndpoint, nil
+	return doc.RevocationEndpoint, nil
 }
 
-// introspectTokenExpiry calls the OAuth 2.0 introspection endpoint (RFC 7662)
-// and returns the token's expiry time.
-func introspectTokenExpiry(ctx context.Context, introspectURL, clientID, token string) (time.Time, error) {
+// introspect calls the OAuth 2.0 introspection endpoint (RFC 7662),
+// authenticating with auth when set.
+func introspect(
+	ctx context.Context,
+	introspectURL string,
+	clientID string,
+	auth *ClientCredentialsAuthenticator,
+	token string,
+	tokenTypeHint string,
+) (*IntrospectionResult, error) {
 	form := url.Values{
-		"token":           {token},
-		"token_type_hint": {"refresh_token"},
-		"client_id":       {clientID},
+		"token": {token},
+	}
+	if tokenTypeHint != "" {
+		form.Set("token_type_hint", tokenTypeHint)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, introspectURL, strings.NewReader(form.Encode()))
+	req, err := newClientRequest(ctx, introspectURL, clientID, auth, form)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("creating introspection request: %w", err)
+		return nil, fmt.Errorf("creating introspection request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClientFromContext(ctx).Do(req)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("calling introspection endpoint: %w", err)
+		return nil, fmt.Errorf("calling introspection endpoint: %w", idpRequestError(err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return time.Time{}, fmt.Errorf("introspection endpoint returned %s", resp.Status)
+		return nil, fmt.Errorf("introspection endpoint returned %s", resp.Status)
 	}
 
-	var result struct {
-		Active bool  `json:"active"`
-		Exp    int64 `json:"exp"`
+	result := &IntrospectionResult{}
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return nil, fmt.Errorf("decoding introspection response: %w", err)
 	}
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, nil
+}
+
+// introspectTokenExpiry introspects a refresh token and returns its expiry time.
+func introspectTokenExpiry(ctx context.Context, introspectURL, clientID, token string) (time.Time, error) {
+	result, err := introspect(ctx, introspectURL, clientID, nil, token, tokenTypeHintRefreshToken)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("decoding introspection response: %w", err)
+		return time.Time{}, err
 	}
+	return refreshTokenExpiry(result)
+}
 
+// refreshTokenExpiry returns the expiry of an introspected refresh token.
+func refreshTokenExpiry(result *IntrospectionResult) (time.Time, error) {
 	if !result.Active {
 		return time.Time{}, fmt.Errorf("refresh token is no longer active")
 	}
 
-	if result.Exp == 0 {
+	if result.Expiry.IsZero() {
 		return time.Time{}, fmt.Errorf("no exp in introspection response")
 	}
 
-	return time.Unix(result.Exp, 0), nil
+	return result.Expiry, nil
 }
@@ -114,3 +114,87 @@ func TestIntrospectTokenExpiryServerError(t *testing.T) {
 	r.Error(err)
 	r.Contains(err.Error(), "500")
 }
+
+func TestIntrospect(t *testing.T) {
+	r := require.New(t)
+
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	issuedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		r.NoError(json.NewEncoder(w).Encode(map[string]string{
+			"introspection_endpoint": srv.URL + "/introspect",
+		}))
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, req *http.Request) {
+		r.NoError(req.ParseForm())
+		r.Equal("my-access-token", req.FormValue("token"))
+		r.Equal("access_token", req.FormValue("token_type_hint"))
+
+		r.NoError(json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":     true,
+			"scope":      "openid email groups",
+			"client_id":  "my-client-id",
+			"username":   "user@example.com",
+			"token_type": "Bearer",
+			"exp":        expiry.Unix(),
+			"iat":        issuedAt.Unix(),
+			"sub":        "00u1234",
+			"aud":        []string{"api://default", "api://other"},
+			"iss":        "https://idp.example.com",
+			"uid":        "00u1234",
+		}))
+	})
+
+	got, err := Introspect(context.Background(), "my-client-id", srv.URL, "my-access-token", "access_token")
+	r.NoError(err)
+	r.True(got.Active)
+	r.Equal([]string{"openid", "email", "groups"}, got.Scopes())
+	r.Equal("my-client-id", got.ClientID)
+	r.Equal("user@example.com", got.Username)
+	r.Equal("Bearer", got.TokenType)
+	r.Equal(expiry, got.Expiry)
+	r.Equal(issuedAt, got.IssuedAt)
+	r.True(got.NotBefore.IsZero())
+	r.Equal("00u1234", got.Subject)
+	r.Equal(Audience{"api://default", "api://other"}, got.Audience)
+	r.Equal("https://idp.example.com", got.Issuer)
+	r.Equal(map[string]interface{}{"uid": "00u1234"}, got.Extra)
+}
+
+func TestIntrospectInactive(t *testing.T) {
+	r := require.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.NoError(req.ParseForm())
+		r.Empty(req.FormValue("token_type_hint"))
+		r.NoError(json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": false,
+		}))
+	}))
+	defer srv.Close()
+
+	got, err := introspect(context.Background(), srv.URL, "client", nil, "token", "")
+	r.NoError(err)
+	r.False(got.Active)
+	r.Empty(got.Extra)
+}
+
+func TestAudienceUnmarshal(t *testing.T) {
+	r := require.New(t)
+
+	var aud Audience
+	r.NoError(json.Unmarshal([]byte(`"single"`), &aud))
+	r.Equal(Audience{"single"}, aud)
+
+	r.NoError(json.Unmarshal([]byte(`["a", "b"]`), &aud))
+	r.Equal(Audience{"a", "b"}, aud)
+	r.True(aud.Contains("b"))
+	r.False(aud.Contains("c"))
+
+	r.Error(json.Unmarshal([]byte(`42`), &aud))
+}
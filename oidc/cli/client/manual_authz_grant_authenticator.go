@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ManualAuthorizationGrantAuthenticator runs the authorization code flow
+// without a browser or callback server, for SSH sessions and other headless
+// hosts. It prints the authorization URL; the user opens it on any machine
+// and pastes back the URL the IdP redirected to. The response is validated
+// exactly like the callback server does (state, PKCE and nonce).
+type ManualAuthorizationGrantAuthenticator struct {
+	redirectURL string
+	timeout     time.Duration
+}
+
+// NewManualAuthorizationGrantAuthenticator returns a manual authenticator.
+// The redirect URL is localhost on config's first port, which must be
+// registered with the IdP just like for the browser flow. The redirect
+// itself is expected to fail to load; only its URL is needed. The user has
+// config's timeout to paste it.
+func NewManualAuthorizationGrantAuthenticator(config *AuthorizationGrantConfig) (*ManualAuthorizationGrantAuthenticator, error) {
+	err := config.ServerConfig.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("could not validate server config: %w", err)
+	}
+
+	return &ManualAuthorizationGrantAuthenticator{
+		redirectURL: fmt.Sprintf("http://localhost:%d", config.ServerConfig.FromPort),
+		timeout:     config.ServerConfig.Timeout,
+	}, nil
+}
+
+// WithManualAuthzGrantAuthenticator authenticates by pasting the redirect
+// URL instead of receiving it on a local callback server.
+func WithManualAuthzGrantAuthenticator(config *AuthorizationGrantConfig) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		authenticator, err := NewManualAuthorizationGrantAuthenticator(config)
+		if err != nil {
+			return fmt.Errorf("creating manual authenticator: %w", err)
+		}
+		c.authenticator = authenticator
+		return nil
+	}
+}
+
+// Authenticate prints the authorization URL and reads the redirect URL
+// from the user.
+func (c *ManualAuthorizationGrantAuthenticator) Authenticate(ctx context.Context, client *OIDCClient) (*Token, error) {
+	client.RedirectURL = c.redirectURL
+
+	oauthMaterial, err := newOauthMaterial()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL := client.AuthCodeURL(oauthMaterial.State, authCodeURLOptions(client, oauthMaterial)...)
+
+	promptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	line, err := client.prompter.RedirectURL(promptCtx, authURL, c.redirectURL)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, fmt.Errorf("timed out after %s waiting for the redirect URL: %w", c.timeout, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading redirect URL: %w", err)
+	}
+
+	query, err := parseRedirectURL(line)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := completeAuthorization(ctx, client, oauthMaterial, query)
+	if err != nil {
+		return nil, err
+	}
+
+	client.prompter.Authenticated(ctx, token)
+	return token, nil
+}
+
+// parseRedirectURL returns the query of a pasted redirect URL. A bare
+// query string ("code=...&state=...") is accepted too; a bare code is not,
+// since the state could not be validated. IdP error responses carry an
+// error instead of a code, but still need the state.
+func parseRedirectURL(pasted string) (url.Values, error) {
+	pasted = strings.TrimSpace(pasted)
+	if pasted == "" {
+		return nil, fmt.Errorf("no redirect URL entered")
+	}
+
+	rawQuery := pasted
+	if i := strings.Index(pasted, "?"); i >= 0 {
+		rawQuery = pasted[i+1:]
+	}
+	if i := strings.Index(rawQuery, "#"); i >= 0 {
+		rawQuery = rawQuery[:i]
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redirect URL: %w", err)
+	}
+	// error responses are reported by completeAuthorization once their
+	// state is validated
+	if (query.Get("code") == "" && query.Get("error") == "") || query.Get("state") == "" {
+		return nil, fmt.Errorf("redirect URL must contain code and state, paste the full URL from the address bar")
+	}
+	return query, nil
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// runManualFlow authenticates against idp, answering the prompt with the
+// line returned by respond for the printed authorization URL.
+func runManualFlow(t *testing.T, idp *fakeIdP, respond func(authURL *url.URL) string) (*Token, error) {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	a, err := NewManualAuthorizationGrantAuthenticator(DefaultAuthorizationGrantConfig)
+	require.NoError(t, err)
+	prompter := &TerminalPrompter{Out: outW, In: inR}
+
+	go func() {
+		scanner := bufio.NewScanner(outR)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, idp.URL+"/authorize") {
+				continue
+			}
+			authURL, err := url.Parse(line)
+			if err != nil {
+				inW.CloseWithError(err)
+				return
+			}
+			idp.setNonce(authURL.Query().Get("nonce"))
+			response := respond(authURL)
+			// keep draining the prompt while the answer is read
+			go fmt.Fprintln(inW, response)
+		}
+	}()
+
+	token, err := a.Authenticate(context.Background(), idp.client(t, WithPrompter(prompter)))
+	outW.Close()
+	return token, err
+}
+
+func TestManualAuthorizationGrant(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	token, err := runManualFlow(t, idp, func(authURL *url.URL) string {
+		q := authURL.Query()
+		r.Equal("S256", q.Get("code_challenge_method"))
+		r.NotEmpty(q.Get("code_challenge"))
+		r.Equal("http://localhost:49152", q.Get("redirect_uri"))
+		return "http://localhost:49152/?code=valid-code&state=" + url.QueryEscape(q.Get("state"))
+	})
+	r.NoError(err)
+	r.Equal("user@example.com", token.Claims.Email)
+	r.NotEmpty(token.IDToken)
+}
+
+func TestManualAuthorizationGrantStateMismatch(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	_, err := runManualFlow(t, idp, func(authURL *url.URL) string {
+		return "http://localhost:49152/?code=valid-code&state=forged"
+	})
+	r.ErrorIs(err, errStateMismatch)
+}
+
+func TestManualAuthorizationGrantErrorStateMismatch(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	_, err := runManualFlow(t, idp, func(authURL *url.URL) string {
+		return "http://localhost:49152/?error=access_denied&state=forged"
+	})
+	r.ErrorIs(err, errStateMismatch)
+	r.NotErrorIs(err, ErrAccessDenied)
+}
+
+func TestManualAuthorizationGrantNonceMismatch(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	_, err := runManualFlow(t, idp, func(authURL *url.URL) string {
+		idp.setNonce("replayed")
+		return "code=valid-code&state=" + url.QueryEscape(authURL.Query().Get("state"))
+	})
+	r.Error(err)
+	r.Contains(err.Error(), "nonce does not match")
+}
+
+func TestManualAuthorizationGrantTimeout(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	a, err := NewManualAuthorizationGrantAuthenticator(&AuthorizationGrantConfig{
+		ServerConfig: &ServerConfig{FromPort: 49152, ToPort: 49152, Timeout: 10 * time.Millisecond},
+	})
+	r.NoError(err)
+	// nobody ever writes to in
+	in, _ := io.Pipe()
+	prompter := &TerminalPrompter{Out: io.Discard, In: in}
+
+	_, err = a.Authenticate(context.Background(), idp.client(t, WithPrompter(prompter)))
+	r.ErrorIs(err, context.DeadlineExceeded)
+	r.Contains(err.Error(), "timed out after 10ms")
+}
+
+func TestManualAuthorizationGrantWithoutTerminal(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	in, w, err := os.Pipe()
+	r.NoError(err)
+	defer in.Close()
+	defer w.Close()
+
+	a, err := NewManualAuthorizationGrantAuthenticator(DefaultAuthorizationGrantConfig)
+	r.NoError(err)
+	prompter := &TerminalPrompter{Out: io.Discard, In: in}
+
+	_, err = a.Authenticate(context.Background(), idp.client(t, WithPrompter(prompter)))
+	r.ErrorIs(err, ErrAuthenticatorUnavailable)
+}
+
+func TestParseRedirectURL(t *testing.T) {
+	r := require.New(t)
+
+	q, err := parseRedirectURL("  http://localhost:49152/?code=abc&state=xyz#_=_\n")
+	r.NoError(err)
+	r.Equal("abc", q.Get("code"))
+	r.Equal("xyz", q.Get("state"))
+
+	q, err = parseRedirectURL("code=abc&state=xyz")
+	r.NoError(err)
+	r.Equal("abc", q.Get("code"))
+
+	q, err = parseRedirectURL("http://localhost:49152/?error=access_denied&state=xyz")
+	r.NoError(err)
+	r.Equal("access_denied", q.Get("error"))
+
+	// the state of an error response can't be validated without it
+	_, err = parseRedirectURL("http://localhost:49152/?error=access_denied")
+	r.Error(err)
+
+	_, err = parseRedirectURL("abc")
+	r.Error(err)
+	_, err = parseRedirectURL("")
+	r.Error(err)
+}
@@ -3,20 +3,30 @@ package client
 import (
 	"context"
 	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+	"github.com/chanzuckerberg/go-misc/osutil"
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
 )
 
 const (
-	// maxRefreshRetries is the number of times to retry token refresh when IDP doesn't return an ID token
+	// maxRefreshRetries is the default number of refresh attempts when the IDP doesn't return an ID token
 	maxRefreshRetries = 5
-	// refreshRetryDelay is the delay between refresh retries
+	// refreshRetryDelay is the default delay between refresh attempts
 	refreshRetryDelay = 15 * time.Second
+
+	// NonInteractiveEnvVar, when set to a true value (e.g. "1", "true"),
+	// has the same effect as WithNonInteractive.
+	NonInteractiveEnvVar = "OIDC_CLI_NON_INTERACTIVE"
 )
 
 var DefaultScopes = []string{
@@ -26,16 +36,49 @@ var DefaultScopes = []string{
 	"groups",
 }
 
+// supportedSigningAlgs are the asymmetric algorithms go-oidc can verify.
+// Algorithms advertised in the discovery document are filtered to these.
+var supportedSigningAlgs = []string{
+	oidc.RS256, oidc.RS384, oidc.RS512,
+	oidc.ES256, oidc.ES384, oidc.ES512,
+	oidc.PS256, oidc.PS384, oidc.PS512,
+	oidc.EdDSA,
+}
+
 type authenticator interface {
 	Authenticate(context.Context, *OIDCClient) (*Token, error)
 }
 
+// isInteractive reports whether a needs the user, which all authenticators
+// but the client credentials grant do.
+func isInteractive(a authenticator) bool {
+	_, ok := a.(*ClientCredentialsAuthenticator)
+	return !ok
+}
+
 type OIDCClient struct {
 	authenticator
 	*oauth2.Config
 	*oidc.IDTokenVerifier
 	issuerURL string
 	log       *slog.Logger
+
+	discovery *DiscoveryCache
+	metadata  *ProviderMetadata
+
+	prompter    Prompter
+	httpClient  *http.Client
+	signingAlgs []string
+	clockSkew   time.Duration
+	audiences   []string
+	requirement *AuthenticationRequirement
+	// nonInteractive disables falling back to an interactive login
+	nonInteractive bool
+	// refreshRetry controls retries of refreshes missing an ID token
+	refreshRetry RefreshRetryPolicy
+	// scopesSet records that the caller chose the scopes with WithScopes
+	// instead of relying on DefaultScopes
+	scopesSet bool
 }
 
 type OIDCClientOption func(context.Context, *OIDCClient) error
@@ -58,45 +101,168 @@ func WithAuthzGrantAuthenticator(a *AuthorizationGrantConfig, authenticatorOptio
 	}
 }
 
+// WithScopes sets the scopes requested at login. The client credentials
+// grant only requests scopes set here, never DefaultScopes.
 func WithScopes(scopes []string) OIDCClientOption {
 	return func(ctx context.Context, c *OIDCClient) error {
 		c.Config.Scopes = scopes
+		c.scopesSet = true
 		return nil
 	}
 }
 
-func NewOIDCClient(ctx context.Context, clientID, issuerURL string, clientOptions ...OIDCClientOption) (*OIDCClient, error) {
-	provider, err := oidc.NewProvider(ctx, issuerURL)
-	if err != nil {
-		return nil, fmt.Errorf("creating oidc provider: %w", err)
+// WithDiscoveryCache looks up the issuer's discovery document through d,
+// e.g. one persisted on disk, instead of the process-wide in-memory cache.
+func WithDiscoveryCache(d *DiscoveryCache) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		c.discovery = d
+		return nil
 	}
+}
 
-	oidcConfig := &oidc.Config{
-		ClientID:             clientID,
-		SupportedSigningAlgs: []string{"RS256"},
+// WithSigningAlgorithms sets the algorithms accepted for ID token
+// signatures (e.g. "RS256", "ES256", "PS256", "EdDSA"). By default the
+// algorithms advertised in the discovery document are accepted, falling
+// back to RS256.
+func WithSigningAlgorithms(algs ...string) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		c.signingAlgs = algs
+		return nil
+	}
+}
+
+// WithClockSkew tolerates ID tokens that expired up to d ago, to cope with
+// clock drift between this host and the IdP.
+func WithClockSkew(d time.Duration) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		if d < 0 {
+			return fmt.Errorf("clock skew must not be negative, got %s", d)
+		}
+		c.clockSkew = d
+		return nil
+	}
+}
+
+// WithAudiences accepts ID tokens whose aud claim contains any of audiences
+// instead of requiring it to contain the client ID.
+func WithAudiences(audiences ...string) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		c.audiences = audiences
+		return nil
+	}
+}
+
+// WithHTTPClient uses httpClient for all requests to the IdP: discovery,
+// key sets, token, introspection and revocation endpoints.
+func WithHTTPClient(httpClient *http.Client) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		c.httpClient = httpClient
+		return nil
 	}
+}
+
+// WithNonInteractive makes RefreshToken fail with ErrInteractiveRequired
+// rather than start an interactive login (browser, device code or manual
+// paste) when the refresh token can't be used, for cron jobs and editor
+// integrations. The client credentials grant still runs since it needs no
+// user. It can also be enabled with the OIDC_CLI_NON_INTERACTIVE
+// environment variable.
+func WithNonInteractive() OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		c.nonInteractive = true
+		return nil
+	}
+}
+
+// nonInteractiveFromEnv reports whether OIDC_CLI_NON_INTERACTIVE is set to
+// a true value. Unparseable values are ignored.
+func nonInteractiveFromEnv(log *slog.Logger) bool {
+	value := os.Getenv(NonInteractiveEnvVar)
+	if value == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warn("ignoring invalid environment variable", "env_var", NonInteractiveEnvVar, "value", value)
+		return false
+	}
+	return enabled
+}
+
+func NewOIDCClient(ctx context.Context, clientID, issuerURL string, clientOptions ...OIDCClientOption) (*OIDCClient, error) {
 	oidcClient := &OIDCClient{
 		Config: &oauth2.Config{
 			ClientID: clientID,
-			Endpoint: provider.Endpoint(),
 			Scopes:   DefaultScopes,
 		},
-		IDTokenVerifier: provider.Verifier(oidcConfig),
-		issuerURL:       issuerURL,
-		log:             logging.FromContext(ctx),
+		issuerURL:    issuerURL,
+		log:          logging.FromContext(ctx),
+		discovery:    defaultDiscoveryCache,
+		prompter:     NewTerminalPrompter(),
+		refreshRetry: DefaultRefreshRetryPolicy,
 	}
+	oidcClient.nonInteractive = nonInteractiveFromEnv(oidcClient.log)
 
 	for _, clientOption := range clientOptions {
-		err = clientOption(ctx, oidcClient)
+		err := clientOption(ctx, oidcClient)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	ctx = oidcClient.clientContext(ctx)
+	metadata, err := oidcClient.discovery.Get(ctx, issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("creating oidc provider: %w", err)
+	}
+	if metadata.Issuer != issuerURL {
+		return nil, fmt.Errorf("creating oidc provider: issuer did not match the issuer returned by provider, expected %q got %q", issuerURL, metadata.Issuer)
+	}
+
+	// Built from the (possibly cached) discovery document rather than
+	// oidc.NewProvider so no network call is made here. Signing keys
+	// are only fetched once an ID token needs verifying.
+	provider := (&oidc.ProviderConfig{
+		IssuerURL:     metadata.Issuer,
+		AuthURL:       metadata.AuthorizationEndpoint,
+		TokenURL:      metadata.TokenEndpoint,
+		DeviceAuthURL: metadata.DeviceAuthorizationEndpoint,
+		UserInfoURL:   metadata.UserinfoEndpoint,
+		JWKSURL:       metadata.JWKSURI,
+		Algorithms:    filterSigningAlgs(metadata.IDTokenSigningAlgValuesSupported),
+	}).NewProvider(ctx)
+
+	oidcConfig := &oidc.Config{
+		ClientID:             clientID,
+		SupportedSigningAlgs: oidcClient.signingAlgs,
+		// the audience is checked in ParseAsIDToken instead
+		SkipClientIDCheck: len(oidcClient.audiences) > 0,
+	}
+	if oidcClient.clockSkew > 0 {
+		skew := oidcClient.clockSkew
+		oidcConfig.Now = func() time.Time {
+			return time.Now().Add(-skew)
+		}
+	}
+	oidcClient.metadata = metadata
+	oidcClient.Config.Endpoint = provider.Endpoint()
+	oidcClient.IDTokenVerifier = provider.Verifier(oidcConfig)
+
 	if oidcClient.authenticator == nil {
-		// this binds to a port, so only do it at the end once we know they didn't set up an
-		// authenticator already
-		err = WithAuthzGrantAuthenticator(DefaultAuthorizationGrantConfig)(ctx, oidcClient)
+		// Fall back to the device flow when the browser flow can't run.
+		// Without a desktop the browser would open on the wrong machine (or
+		// not at all), so have the user paste the redirect URL instead,
+		// unless there is no terminal to paste it into.
+		interactive := WithAuthzGrantAuthenticator(DefaultAuthorizationGrantConfig)
+		if !osutil.IsDesktopEnvironment() {
+			oidcClient.log.Debug("NewOIDCClient: no desktop environment, using manual authorization grant")
+			interactive = WithManualAuthzGrantAuthenticator(DefaultAuthorizationGrantConfig)
+		}
+		defaultAuthenticator := WithFallbackAuthenticators(
+			interactive,
+			WithDeviceGrantAuthenticator(NewDeviceGrantAuthenticator()),
+		)
+		err = defaultAuthenticator(ctx, oidcClient)
 		if err != nil {
 			return nil, err
 		}
@@ -105,6 +271,40 @@ func NewOIDCClient(ctx context.Context, clientID, issuerURL string, clientOption
 	return oidcClient, nil
 }
 
+// filterSigningAlgs returns the algorithms in algs that go-oidc supports.
+func filterSigningAlgs(algs []string) []string {
+	var filtered []string
+	for _, alg := range algs {
+		if slices.Contains(supportedSigningAlgs, alg) {
+			filtered = append(filtered, alg)
+		}
+	}
+	return filtered
+}
+
+// clientContext returns ctx carrying the configured HTTP client, which
+// oauth2, go-oidc and this package's own requests pick up.
+func (c *OIDCClient) clientContext(ctx context.Context) context.Context {
+	if c.httpClient == nil {
+		return ctx
+	}
+	return oidc.ClientContext(ctx, c.httpClient)
+}
+
+// httpClientFromContext returns the HTTP client set with oidc.ClientContext,
+// or http.DefaultClient.
+func httpClientFromContext(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && c != nil {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// Metadata returns the issuer's discovery document.
+func (c *OIDCClient) Metadata() *ProviderMetadata {
+	return c.metadata
+}
+
 func (c *OIDCClient) ParseAsIDToken(ctx context.Context, oauth2Token *oauth2.Token) (*Claims, *oidc.IDToken, string, error) {
 	idTokenStr, ok := oauth2Token.Extra("id_token").(string)
 	if !ok {
@@ -117,6 +317,9 @@ func (c *OIDCClient) ParseAsIDToken(ctx context.Context, oauth2Token *oauth2.Tok
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("verifying ID token: %w", err)
 	}
+	if len(c.audiences) > 0 && !slices.ContainsFunc(c.audiences, Audience(idToken.Audience).Contains) {
+		return nil, nil, "", fmt.Errorf("verifying ID token: expected audience in %q got %q", c.audiences, idToken.Audience)
+	}
 
 	claims := &Claims{}
 	err = idToken.Claims(claims)
@@ -128,24 +331,45 @@ func (c *OIDCClient) ParseAsIDToken(ctx context.Context, oauth2Token *oauth2.Tok
 }
 
 // RefreshToken will fetch a new token. After a successful refresh it
-// introspects the new refresh token to populate RefreshTokenExpiry.
+// introspects the new refresh token to populate RefreshTokenExpiry. A token
+// not satisfying the client's authentication requirement is not refreshed,
+// since refreshing keeps the original authentication; the user logs in
+// again instead.
 func (c *OIDCClient) RefreshToken(ctx context.Context, oldToken *Token) (*Token, error) {
-	// Try refresh_token grant first
-	newToken, err := c.refreshToken(ctx, oldToken)
-	if err == nil {
-		c.log.Debug("OIDCClient.RefreshToken: refreshed via refresh_token grant",
-			"new_expiry", newToken.Token.Expiry,
-			"email", newToken.Claims.Email,
+	ctx = c.clientContext(ctx)
+
+	var refreshErr error
+	if oldToken != nil {
+		refreshErr = c.requirement.Check(oldToken)
+	}
+	if refreshErr == nil {
+		// Try refresh_token grant first
+		newToken, err := c.RefreshTokenNonInteractive(ctx, oldToken)
+		if err == nil {
+			return newToken, nil
+		}
+		refreshErr = err
+	}
+
+	if c.nonInteractive && isInteractive(c.authenticator) {
+		c.log.Debug("OIDCClient.RefreshToken: cannot refresh, interactive auth disabled",
+			"reason", refreshErr.Error(),
 		)
-		c.tryPopulateRefreshExpiry(ctx, newToken)
-		return newToken, nil
+		return nil, fmt.Errorf("%w: %w", ErrInteractiveRequired, refreshErr)
 	}
 
 	// Fall back to interactive authentication
-	c.log.Debug("OIDCClient.RefreshToken: refresh_token grant failed, falling back to interactive auth",
-		"reason", err.Error(),
+	c.log.Debug("OIDCClient.RefreshToken: cannot refresh, falling back to interactive auth",
+		"reason", refreshErr.Error(),
 	)
 	token, err := c.authenticator.Authenticate(ctx, c)
+	if errors.Is(err, ErrAuthenticatorUnavailable) {
+		return nil, fmt.Errorf("%w: %w (after refresh failed: %w)", ErrInteractiveRequired, err, refreshErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = c.requirement.Check(token)
 	if err != nil {
 		return nil, err
 	}
@@ -153,6 +377,25 @@ func (c *OIDCClient) RefreshToken(ctx context.Context, oldToken *Token) (*Token,
 	return token, nil
 }
 
+// RefreshTokenNonInteractive fetches a new token with the refresh_token
+// grant only, never falling back to an interactive login, e.g. to refresh a
+// token that is still valid ahead of its expiry.
+func (c *OIDCClient) RefreshTokenNonInteractive(ctx context.Context, oldToken *Token) (*Token, error) {
+	ctx = c.clientContext(ctx)
+
+	newToken, err := c.refreshToken(ctx, oldToken)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Debug("OIDCClient.RefreshToken: refreshed via refresh_token grant",
+		"new_expiry", newToken.Token.Expiry,
+		"email", newToken.Claims.Email,
+	)
+	c.tryPopulateRefreshExpiry(ctx, newToken)
+	return newToken, nil
+}
+
 // tryPopulateRefreshExpiry introspects the token's refresh token and sets
 // RefreshTokenExpiry. Failures are logged but not propagated.
 func (c *OIDCClient) tryPopulateRefreshExpiry(ctx context.Context, tok *Token) {
@@ -160,7 +403,12 @@ func (c *OIDCClient) tryPopulateRefreshExpiry(ctx context.Context, tok *Token) {
 		return
 	}
 
-	expiry, err := LookupRefreshExpiry(ctx, c.ClientID, c.issuerURL, tok.Token.RefreshToken)
+	if c.metadata.IntrospectionEndpoint == "" {
+		c.log.Debug("no introspection_endpoint in discovery document, skipping refresh token expiry lookup")
+		return
+	}
+
+	expiry, err := c.LookupRefreshExpiry(ctx, tok.Token.RefreshToken)
 	if err != nil {
 		c.log.Warn("introspecting refresh token expiry", "error", err)
 		return
@@ -188,7 +436,8 @@ func (c *OIDCClient) refreshToken(ctx context.Context, existingToken *Token) (*T
 		newOauth2Token *oauth2.Token
 		err            error
 	)
-	for attempt := 1; attempt <= maxRefreshRetries; attempt++ {
+	retrier := c.refreshRetry.start(ctx)
+	for attempt := 1; ; attempt++ {
 		newOauth2Token, err = c.TokenSource(ctx, existingToken.Token).Token()
 		if err != nil {
 			// This is expected if refresh token is expired - not an error severity
@@ -196,7 +445,11 @@ func (c *OIDCClient) refreshToken(ctx context.Context, existingToken *Token) (*T
 				"attempt", attempt,
 				"error", err.Error(),
 			)
-			return nil, fmt.Errorf("refreshing token: %w", err)
+			var retrieveErr *oauth2.RetrieveError
+			if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+				return nil, fmt.Errorf("refreshing token: %w: %w", ErrRefreshTokenRevoked, err)
+			}
+			return nil, fmt.Errorf("refreshing token: %w", idpRequestError(err))
 		}
 
 		c.log.Debug("OIDCClient.refreshToken: received new oauth2 token",
@@ -227,15 +480,26 @@ func (c *OIDCClient) refreshToken(ctx context.Context, existingToken *Token) (*T
 			}, nil
 		}
 
+		delay, retry, err := retrier.next()
+		if err != nil {
+			return nil, err
+		}
+		if !retry {
+			break
+		}
+		c.log.Debug("OIDCClient.refreshToken: no ID token in response, retrying",
+			"attempt", attempt,
+			"delay", delay,
+		)
 		select {
-		case <-time.After(refreshRetryDelay):
+		case <-time.After(delay):
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		}
 	}
 
-	c.log.Debug("OIDCClient.refreshToken: IDP did not return new ID token after retries, reusing existing",
-		"attempts", maxRefreshRetries,
+	c.log.Debug("OIDCClient.refreshToken: IDP did not return new ID token, reusing existing",
+		"attempts", retrier.attempts,
 	)
 	// After all retries, if we still don't have an ID token, use the existing one
 	// Sometimes, the IDP won't send a new ID token, per the spec. It's optional.
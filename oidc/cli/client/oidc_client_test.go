@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// fakeIdP serves a discovery document and a JWKS for an ES256 key. Its
+// token endpoint accepts the authorization code "valid-code" and the
+// refresh token "valid-refresh", and returns an ID token carrying the
+// nonce of the last authorization request. It answers client credentials
+// requests with the access token "machine-token" and token exchanges with
+// "<audience>:<subject_token_type>:<scope>", refusing the audience
+// "forbidden" and omitting expires_in for "no-expiry". Its introspection
+// endpoint reports every token active for another day and its revocation
+// endpoint accepts every token. Requests to these endpoints are recorded
+// for the test to inspect.
+type fakeIdP struct {
+	*httptest.Server
+	key *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	nonce    string
+	requests map[string][]*http.Request
+}
+
+func (idp *fakeIdP) recordRequest(req *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.requests[req.URL.Path] = append(idp.requests[req.URL.Path], req)
+}
+
+// lastRequest returns the last request to path, with its form already
+// parsed.
+func (idp *fakeIdP) lastRequest(t *testing.T, path string) *http.Request {
+	t.Helper()
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	requests := idp.requests[path]
+	require.NotEmpty(t, requests, "no request to %s", path)
+	return requests[len(requests)-1]
+}
+
+// lastTokenRequest returns the last request to the token endpoint.
+func (idp *fakeIdP) lastTokenRequest(t *testing.T) *http.Request {
+	t.Helper()
+	return idp.lastRequest(t, "/token")
+}
+
+func (idp *fakeIdP) setNonce(nonce string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.nonce = nonce
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	idp := &fakeIdP{key: key, requests: map[string][]*http.Request{}}
+	idp.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+				"issuer":                                idp.URL,
+				"authorization_endpoint":                idp.URL + "/authorize",
+				"token_endpoint":                        idp.URL + "/token",
+				"jwks_uri":                              idp.URL + "/keys",
+				"introspection_endpoint":                idp.URL + "/introspect",
+				"revocation_endpoint":                   idp.URL + "/revoke",
+				"id_token_signing_alg_values_supported": []string{"ES256", "HS256"},
+			})
+		case "/introspect", "/revoke":
+			if err := req.ParseForm(); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			idp.recordRequest(req)
+			if req.URL.Path == "/introspect" {
+				json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+					"active": true,
+					"exp":    time.Now().Add(24 * time.Hour).Unix(),
+				})
+			}
+		case "/token":
+			if err := req.ParseForm(); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"}) //nolint:errcheck
+				return
+			}
+			idp.recordRequest(req)
+			switch req.PostForm.Get("grant_type") {
+			case "client_credentials":
+				json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+					"access_token": "machine-token",
+					"token_type":   "Bearer",
+					"expires_in":   3600,
+				})
+				return
+			case grantTypeTokenExchange:
+				if req.PostForm.Get("audience") == "forbidden" {
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+						"error":             "invalid_target",
+						"error_description": "audience not allowed",
+					})
+					return
+				}
+				response := map[string]interface{}{
+					"access_token":      req.PostForm.Get("audience") + ":" + req.PostForm.Get("subject_token_type") + ":" + req.PostForm.Get("scope"),
+					"issued_token_type": TokenTypeAccessToken,
+					"token_type":        "Bearer",
+					"expires_in":        600,
+				}
+				if req.PostForm.Get("audience") == "no-expiry" {
+					delete(response, "expires_in")
+				}
+				json.NewEncoder(w).Encode(response) //nolint:errcheck
+				return
+			}
+			validCode := req.FormValue("code") == "valid-code" && req.FormValue("code_verifier") != ""
+			if !validCode && req.FormValue("refresh_token") != "valid-refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"}) //nolint:errcheck
+				return
+			}
+			token, err := idp.signIDToken("client-id", time.Now().Add(time.Hour))
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "server_error", "error_description": err.Error()}) //nolint:errcheck
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+				"access_token": token.AccessToken,
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+				"id_token":     token.Extra("id_token"),
+			})
+		case "/keys":
+			json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{ //nolint:errcheck
+				{Key: &key.PublicKey, KeyID: "test", Algorithm: "ES256", Use: "sig"},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// idToken returns an oauth2.Token carrying an ES256-signed ID token.
+func (idp *fakeIdP) idToken(t *testing.T, aud string, expiry time.Time) *oauth2.Token {
+	t.Helper()
+	token, err := idp.signIDToken(aud, expiry)
+	require.NoError(t, err)
+	return token
+}
+
+// signIDToken is idToken for the token endpoint's handler, which must not
+// fail the test from its goroutine.
+func (idp *fakeIdP) signIDToken(aud string, expiry time.Time) (*oauth2.Token, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: idp.key},
+		(&jose.SignerOptions{}).WithHeader("kid", "test"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	idp.mu.Lock()
+	nonce := idp.nonce
+	idp.mu.Unlock()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"iss":   idp.URL,
+		"sub":   "user",
+		"aud":   aud,
+		"email": "user@example.com",
+		"nonce": nonce,
+		"iat":   time.Now().Add(-time.Hour).Unix(),
+		"exp":   expiry.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := jws.CompactSerialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": raw}), nil
+}
+
+func (idp *fakeIdP) client(t *testing.T, opts ...OIDCClientOption) *OIDCClient {
+	t.Helper()
+	opts = append([]OIDCClientOption{WithDiscoveryCache(NewDiscoveryCache("", 0))}, opts...)
+	c, err := NewOIDCClient(context.Background(), "client-id", idp.URL, opts...)
+	require.NoError(t, err)
+	return c
+}
+
+func TestParseAsIDTokenDiscoveredAlgorithms(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	claims, _, _, err := idp.client(t).ParseAsIDToken(context.Background(), idp.idToken(t, "client-id", time.Now().Add(time.Hour)))
+	r.NoError(err)
+	r.Equal("user@example.com", claims.Email)
+}
+
+func TestParseAsIDTokenSigningAlgorithms(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	c := idp.client(t, WithSigningAlgorithms("RS256"))
+	_, _, _, err := c.ParseAsIDToken(context.Background(), idp.idToken(t, "client-id", time.Now().Add(time.Hour)))
+	r.Error(err)
+	r.Contains(err.Error(), "unexpected signature algorithm")
+}
+
+func TestParseAsIDTokenAudiences(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	ctx := context.Background()
+
+	c := idp.client(t, WithAudiences("api://default"))
+	_, _, _, err := c.ParseAsIDToken(ctx, idp.idToken(t, "api://default", time.Now().Add(time.Hour)))
+	r.NoError(err)
+
+	_, _, _, err = c.ParseAsIDToken(ctx, idp.idToken(t, "client-id", time.Now().Add(time.Hour)))
+	r.Error(err)
+	r.Contains(err.Error(), "expected audience")
+}
+
+func TestParseAsIDTokenClockSkew(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	ctx := context.Background()
+	token := idp.idToken(t, "client-id", time.Now().Add(-30*time.Second))
+
+	_, _, _, err := idp.client(t).ParseAsIDToken(ctx, token)
+	r.Error(err)
+
+	_, _, _, err = idp.client(t, WithClockSkew(time.Minute)).ParseAsIDToken(ctx, token)
+	r.NoError(err)
+
+	_, err = NewOIDCClient(ctx, "client-id", idp.URL, WithClockSkew(-time.Minute))
+	r.Error(err)
+}
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	transport := &countingTransport{}
+
+	c := idp.client(t, WithHTTPClient(&http.Client{Transport: transport}))
+	r.Equal(int32(1), transport.requests.Load())
+
+	// verifying fetches the key set through the same client
+	_, _, _, err := c.ParseAsIDToken(context.Background(), idp.idToken(t, "client-id", time.Now().Add(time.Hour)))
+	r.NoError(err)
+	r.Equal(int32(2), transport.requests.Load())
+}
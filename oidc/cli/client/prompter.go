@@ -0,0 +1,223 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeviceCode is what the user needs to complete the device flow.
+type DeviceCode struct {
+	VerificationURI string
+	// VerificationURIComplete embeds the user code, when the IdP
+	// provides it, so it can be opened (or scanned) directly.
+	VerificationURIComplete string
+	UserCode                string
+	Expiry                  time.Time
+}
+
+// Prompter renders authentication prompts and progress to the user, so
+// GUIs, editor extensions and wrapper CLIs can present them their own way.
+type Prompter interface {
+	// OpeningBrowser is called before the browser is opened at authURL.
+	OpeningBrowser(ctx context.Context, authURL string)
+	// DeviceCode is called once the device flow has a code to display.
+	DeviceCode(ctx context.Context, code *DeviceCode)
+	// RedirectURL asks the user to open authURL and returns the URL they
+	// were redirected to (on redirectURL), for the manual flow.
+	RedirectURL(ctx context.Context, authURL, redirectURL string) (string, error)
+	// Authenticated is called when authentication succeeded.
+	Authenticated(ctx context.Context, token *Token)
+}
+
+// WithPrompter sets how authenticators interact with the user. The
+// default is a TerminalPrompter.
+func WithPrompter(p Prompter) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		c.prompter = p
+		return nil
+	}
+}
+
+// TerminalPrompter writes human readable prompts to Out and reads input
+// from In.
+type TerminalPrompter struct {
+	Out io.Writer
+	In  io.Reader
+	// NoQRCode disables the QR code of the device flow's
+	// verification_uri_complete.
+	NoQRCode bool
+}
+
+// NewTerminalPrompter returns a prompter on stderr and stdin.
+func NewTerminalPrompter() *TerminalPrompter {
+	return &TerminalPrompter{Out: os.Stderr, In: os.Stdin}
+}
+
+func (p *TerminalPrompter) OpeningBrowser(_ context.Context, authURL string) {
+	fmt.Fprintf(p.Out, "Opening browser in order to authenticate, hold on a brief second...\n")
+	fmt.Fprintf(p.Out, "If it does not open, visit:\n\n    %s\n\n", authURL)
+}
+
+func (p *TerminalPrompter) DeviceCode(_ context.Context, code *DeviceCode) {
+	if code.VerificationURIComplete != "" && !p.NoQRCode {
+		fmt.Fprintf(p.Out, "\nScan to sign in from your phone, or open %s\n\n", code.VerificationURIComplete)
+		err := renderQRCode(p.Out, code.VerificationURIComplete, isUTF8Locale())
+		if err != nil {
+			fmt.Fprintf(p.Out, "(could not render QR code: %s)\n", err)
+		}
+	}
+
+	data := &deviceAuthTemplateData{
+		VerificationURI:  code.VerificationURI,
+		UserCode:         code.UserCode,
+		ExpiresInMinutes: int(time.Until(code.Expiry).Minutes()),
+	}
+	err := renderDeviceAuthTemplate(p.Out, data)
+	if err != nil {
+		// fall back to the bare essentials
+		fmt.Fprintf(p.Out, "Open %s and enter the code %s\n", code.VerificationURI, code.UserCode)
+	}
+}
+
+// RedirectURL fails with ErrAuthenticatorUnavailable when In is a file
+// that is not a terminal, e.g. stdin of a cron job or a pipe, since nobody
+// could paste the URL.
+func (p *TerminalPrompter) RedirectURL(ctx context.Context, authURL, redirectURL string) (string, error) {
+	if !isTerminal(p.In) {
+		return "", fmt.Errorf("cannot prompt for the redirect URL, input is not a terminal: %w", ErrAuthenticatorUnavailable)
+	}
+	fmt.Fprintf(p.Out, "Open the following URL in a browser on any machine to authenticate:\n\n    %s\n\n", authURL)
+	fmt.Fprintf(p.Out, "After signing in, your browser is redirected to %s, which will fail to load.\n", redirectURL)
+	fmt.Fprintf(p.Out, "Paste the full URL from the browser's address bar here: ")
+	return readLine(ctx, p.In)
+}
+
+func (p *TerminalPrompter) Authenticated(context.Context, *Token) {
+	fmt.Fprintf(p.Out, "\n✓ Successfully authenticated!\n")
+}
+
+// JSONLinesPrompter writes each prompt as a JSON object on its own line to
+// Out, for tools wrapping the CLI. The redirect URL of the manual flow is
+// read as a line from In.
+type JSONLinesPrompter struct {
+	Out io.Writer
+	In  io.Reader
+
+	mu sync.Mutex
+}
+
+// NewJSONLinesPrompter returns a prompter writing to stdout and reading
+// from stdin.
+func NewJSONLinesPrompter() *JSONLinesPrompter {
+	return &JSONLinesPrompter{Out: os.Stdout, In: os.Stdin}
+}
+
+// PromptEvent is a line written by JSONLinesPrompter.
+type PromptEvent struct {
+	Event                   string     `json:"event"`
+	URL                     string     `json:"url,omitempty"`
+	RedirectURL             string     `json:"redirect_url,omitempty"`
+	VerificationURI         string     `json:"verification_uri,omitempty"`
+	VerificationURIComplete string     `json:"verification_uri_complete,omitempty"`
+	UserCode                string     `json:"user_code,omitempty"`
+	ExpiresAt               *time.Time `json:"expires_at,omitempty"`
+	Email                   string     `json:"email,omitempty"`
+}
+
+// Events written by JSONLinesPrompter.
+const (
+	PromptEventOpeningBrowser = "opening_browser"
+	PromptEventDeviceCode     = "device_code"
+	PromptEventRedirectURL    = "redirect_url_required"
+	PromptEventAuthenticated  = "authenticated"
+)
+
+func (p *JSONLinesPrompter) write(event *PromptEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	json.NewEncoder(p.Out).Encode(event) //nolint:errcheck
+}
+
+func (p *JSONLinesPrompter) OpeningBrowser(_ context.Context, authURL string) {
+	p.write(&PromptEvent{Event: PromptEventOpeningBrowser, URL: authURL})
+}
+
+func (p *JSONLinesPrompter) DeviceCode(_ context.Context, code *DeviceCode) {
+	event := &PromptEvent{
+		Event:                   PromptEventDeviceCode,
+		VerificationURI:         code.VerificationURI,
+		VerificationURIComplete: code.VerificationURIComplete,
+		UserCode:                code.UserCode,
+	}
+	if !code.Expiry.IsZero() {
+		event.ExpiresAt = &code.Expiry
+	}
+	p.write(event)
+}
+
+func (p *JSONLinesPrompter) RedirectURL(ctx context.Context, authURL, redirectURL string) (string, error) {
+	p.write(&PromptEvent{Event: PromptEventRedirectURL, URL: authURL, RedirectURL: redirectURL})
+	return readLine(ctx, p.In)
+}
+
+func (p *JSONLinesPrompter) Authenticated(_ context.Context, token *Token) {
+	p.write(&PromptEvent{Event: PromptEventAuthenticated, Email: token.Claims.Email})
+}
+
+// SilentPrompter displays nothing, for callers that must not write to the
+// terminal, e.g. with the client credentials grant. The manual flow is
+// unavailable with it since it needs input from the user.
+type SilentPrompter struct{}
+
+func (SilentPrompter) OpeningBrowser(context.Context, string) {}
+
+func (SilentPrompter) DeviceCode(context.Context, *DeviceCode) {}
+
+func (SilentPrompter) RedirectURL(context.Context, string, string) (string, error) {
+	return "", fmt.Errorf("cannot prompt for the redirect URL: %w", ErrAuthenticatorUnavailable)
+}
+
+func (SilentPrompter) Authenticated(context.Context, *Token) {}
+
+// isTerminal reports whether in is a character device. Readers other than
+// files are assumed to be driven by someone, as with GUIs and tests.
+func isTerminal(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	if !ok {
+		return true
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// readLine reads a line from in, giving up when ctx is done.
+func readLine(ctx context.Context, in io.Reader) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	lines := make(chan result, 1)
+	go func() {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		lines <- result{line: line, err: err}
+	}()
+
+	select {
+	case r := <-lines:
+		return r.line, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
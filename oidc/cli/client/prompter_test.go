@@ -0,0 +1,78 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestJSONLinesPrompter(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	out := &bytes.Buffer{}
+	p := &JSONLinesPrompter{Out: out, In: strings.NewReader("http://localhost:49152/?code=c&state=s\n")}
+
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.DeviceCode(ctx, &DeviceCode{
+		VerificationURI:         "https://idp.example.com/activate",
+		VerificationURIComplete: "https://idp.example.com/activate?user_code=ABCD",
+		UserCode:                "ABCD",
+		Expiry:                  expiry,
+	})
+	line, err := p.RedirectURL(ctx, "https://idp.example.com/authorize", "http://localhost:49152")
+	r.NoError(err)
+	r.Equal("http://localhost:49152/?code=c&state=s\n", line)
+	p.Authenticated(ctx, &Token{Token: &oauth2.Token{}, Claims: Claims{Email: "user@example.com"}})
+
+	var events []PromptEvent
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var e PromptEvent
+		r.NoError(dec.Decode(&e))
+		events = append(events, e)
+	}
+	r.Len(events, 3)
+
+	r.Equal(PromptEventDeviceCode, events[0].Event)
+	r.Equal("ABCD", events[0].UserCode)
+	r.Equal("https://idp.example.com/activate?user_code=ABCD", events[0].VerificationURIComplete)
+	r.True(expiry.Equal(*events[0].ExpiresAt))
+
+	r.Equal(PromptEventRedirectURL, events[1].Event)
+	r.Equal("https://idp.example.com/authorize", events[1].URL)
+	r.Equal("http://localhost:49152", events[1].RedirectURL)
+
+	r.Equal(PromptEventAuthenticated, events[2].Event)
+	r.Equal("user@example.com", events[2].Email)
+}
+
+func TestTerminalPrompterDeviceCode(t *testing.T) {
+	r := require.New(t)
+	out := &bytes.Buffer{}
+	p := &TerminalPrompter{Out: out}
+
+	p.DeviceCode(context.Background(), &DeviceCode{
+		VerificationURI: "https://idp.example.com/activate",
+		UserCode:        "ABCD-EFGH",
+		Expiry:          time.Now().Add(10 * time.Minute),
+	})
+	r.Contains(out.String(), "https://idp.example.com/activate")
+	r.Contains(out.String(), "ABCD-EFGH")
+}
+
+func TestSilentPrompterManualFlowUnavailable(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+
+	a, err := NewManualAuthorizationGrantAuthenticator(DefaultAuthorizationGrantConfig)
+	r.NoError(err)
+
+	_, err = a.Authenticate(context.Background(), idp.client(t, WithPrompter(SilentPrompter{})))
+	r.ErrorIs(err, ErrAuthenticatorUnavailable)
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// renderQRCode writes content as a QR code for a terminal with a light
+// foreground on a dark background. With unicode, each line holds two rows
+// of modules using half blocks; otherwise each module is two ASCII
+// characters wide so the code stays roughly square.
+func renderQRCode(w io.Writer, content string, unicode bool) error {
+	qr, err := qrcode.New(content, qrcode.Low)
+	if err != nil {
+		return fmt.Errorf("encoding QR code: %w", err)
+	}
+	// the bitmap includes the quiet zone; true is a dark module
+	bitmap := qr.Bitmap()
+
+	var b strings.Builder
+	if unicode {
+		for y := 0; y < len(bitmap); y += 2 {
+			for x := range bitmap[y] {
+				top := bitmap[y][x]
+				bottom := true
+				if y+1 < len(bitmap) {
+					bottom = bitmap[y+1][x]
+				}
+				switch {
+				case !top && !bottom:
+					b.WriteString("█")
+				case !top:
+					b.WriteString("▀")
+				case !bottom:
+					b.WriteString("▄")
+				default:
+					b.WriteString(" ")
+				}
+			}
+			b.WriteString("\n")
+		}
+	} else {
+		for _, row := range bitmap {
+			for _, dark := range row {
+				if dark {
+					b.WriteString("  ")
+				} else {
+					b.WriteString("##")
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// isUTF8Locale reports whether the locale environment selects UTF-8, in
+// the precedence order used by setlocale.
+func isUTF8Locale() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			value = strings.ToLower(value)
+			return strings.Contains(value, "utf-8") || strings.Contains(value, "utf8")
+		}
+	}
+	return false
+}
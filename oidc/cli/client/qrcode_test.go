@@ -0,0 +1,66 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderQRCode(t *testing.T) {
+	r := require.New(t)
+	content := "https://idp.example.com/activate?user_code=ABCD-EFGH"
+
+	ascii := &bytes.Buffer{}
+	r.NoError(renderQRCode(ascii, content, false))
+	asciiLines := strings.Split(strings.TrimSuffix(ascii.String(), "\n"), "\n")
+	r.NotContains(ascii.String(), "█")
+	// square: each module is two characters wide
+	r.Len(asciiLines[0], 2*len(asciiLines))
+
+	unicode := &bytes.Buffer{}
+	r.NoError(renderQRCode(unicode, content, true))
+	unicodeLines := strings.Split(strings.TrimSuffix(unicode.String(), "\n"), "\n")
+	// two rows of modules per line
+	r.Equal((len(asciiLines)+1)/2, len(unicodeLines))
+	r.Contains(unicode.String(), "▀")
+}
+
+func TestIsUTF8Locale(t *testing.T) {
+	r := require.New(t)
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_CTYPE", "")
+
+	t.Setenv("LANG", "en_US.UTF-8")
+	r.True(isUTF8Locale())
+
+	t.Setenv("LC_ALL", "C")
+	r.False(isUTF8Locale())
+
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LANG", "")
+	r.False(isUTF8Locale())
+}
+
+func TestTerminalPrompterQRCode(t *testing.T) {
+	r := require.New(t)
+	t.Setenv("LC_ALL", "en_US.UTF-8")
+	code := &DeviceCode{
+		VerificationURI:         "https://idp.example.com/activate",
+		VerificationURIComplete: "https://idp.example.com/activate?user_code=ABCD",
+		UserCode:                "ABCD",
+		Expiry:                  time.Now().Add(10 * time.Minute),
+	}
+
+	out := &bytes.Buffer{}
+	(&TerminalPrompter{Out: out}).DeviceCode(context.Background(), code)
+	r.Contains(out.String(), "█")
+	r.Contains(out.String(), code.VerificationURIComplete)
+
+	out.Reset()
+	(&TerminalPrompter{Out: out, NoQRCode: true}).DeviceCode(context.Background(), code)
+	r.NotContains(out.String(), "█")
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// RefreshRetryPolicy controls how a refresh is retried when the IdP's
+// response has no ID token, which it may omit (e.g. Okta does while the
+// previous one is unexpired). Once retries are exhausted, the refreshed
+// access token is kept along with the existing ID token.
+type RefreshRetryPolicy struct {
+	// MaxAttempts is the number of refresh requests made. Zero uses the
+	// default of 5.
+	MaxAttempts int
+	// NewBackOff returns the delays between attempts, the same strategies
+	// pidlock.Lock accepts, e.g. a backoff.ExponentialBackOff whose
+	// RandomizationFactor adds jitter. It is called for every refresh.
+	// Nil waits 15s between attempts.
+	NewBackOff func() backoff.BackOff
+	// Deadline bounds the time spent retrying, zero means no bound.
+	// Canceling the refresh's context, or reaching its deadline, fails the
+	// refresh with the context's error instead.
+	Deadline time.Duration
+	// AcceptMissingIDToken keeps the existing ID token as soon as a
+	// response lacks one, without retrying.
+	AcceptMissingIDToken bool
+}
+
+// DefaultRefreshRetryPolicy makes up to 5 attempts 15s apart.
+var DefaultRefreshRetryPolicy = RefreshRetryPolicy{
+	MaxAttempts: maxRefreshRetries,
+	NewBackOff: func() backoff.BackOff {
+		return backoff.NewConstantBackOff(refreshRetryDelay)
+	},
+}
+
+// WithRefreshRetryPolicy sets how refreshes missing an ID token are
+// retried, instead of DefaultRefreshRetryPolicy.
+func WithRefreshRetryPolicy(policy RefreshRetryPolicy) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		if policy.MaxAttempts < 0 {
+			return fmt.Errorf("max attempts must not be negative, got %d", policy.MaxAttempts)
+		}
+		if policy.Deadline < 0 {
+			return fmt.Errorf("deadline must not be negative, got %s", policy.Deadline)
+		}
+		c.refreshRetry = policy
+		return nil
+	}
+}
+
+// refreshRetrier tracks the retries of a single refresh.
+type refreshRetrier struct {
+	ctx      context.Context
+	policy   RefreshRetryPolicy
+	backOff  backoff.BackOff
+	deadline time.Time
+	attempts int
+}
+
+func (p RefreshRetryPolicy) start(ctx context.Context) *refreshRetrier {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultRefreshRetryPolicy.MaxAttempts
+	}
+	if p.NewBackOff == nil {
+		p.NewBackOff = DefaultRefreshRetryPolicy.NewBackOff
+	}
+
+	b := p.NewBackOff()
+	b.Reset()
+	r := &refreshRetrier{
+		ctx:     ctx,
+		policy:  p,
+		backOff: b,
+	}
+	if p.Deadline > 0 {
+		r.deadline = time.Now().Add(p.Deadline)
+	}
+	return r
+}
+
+// next returns how long to wait before the next attempt, or false when the
+// policy accepts the missing ID token. It fails once the refresh's context
+// is done: giving up early is not the policy's choice.
+func (r *refreshRetrier) next() (time.Duration, bool, error) {
+	err := r.ctx.Err()
+	if err != nil {
+		return 0, false, err
+	}
+
+	r.attempts++
+	if r.policy.AcceptMissingIDToken || r.attempts >= r.policy.MaxAttempts {
+		return 0, false, nil
+	}
+
+	delay := r.backOff.NextBackOff()
+	if delay == backoff.Stop {
+		return 0, false, nil
+	}
+	if !r.deadline.IsZero() && time.Now().Add(delay).After(r.deadline) {
+		return 0, false, nil
+	}
+	return delay, true, nil
+}
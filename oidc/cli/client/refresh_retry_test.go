@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// newNoIDTokenIdP serves a token endpoint that refreshes access tokens
+// without returning an ID token, counting the refreshes.
+func newNoIDTokenIdP(t *testing.T, refreshes *atomic.Int32) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+				"issuer":         srv.URL,
+				"token_endpoint": srv.URL + "/token",
+				"jwks_uri":       srv.URL + "/keys",
+			})
+		case "/token":
+			refreshes.Add(1)
+			json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+				"access_token": "refreshed",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRefreshRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    RefreshRetryPolicy
+		refreshes int32
+	}{
+		{
+			name:      "accept missing ID token",
+			policy:    RefreshRetryPolicy{AcceptMissingIDToken: true},
+			refreshes: 1,
+		},
+		{
+			name: "max attempts",
+			policy: RefreshRetryPolicy{
+				MaxAttempts: 3,
+				NewBackOff:  func() backoff.BackOff { return &backoff.ZeroBackOff{} },
+			},
+			refreshes: 3,
+		},
+		{
+			name: "deadline",
+			policy: RefreshRetryPolicy{
+				NewBackOff: func() backoff.BackOff { return backoff.NewConstantBackOff(time.Hour) },
+				Deadline:   time.Minute,
+			},
+			refreshes: 1,
+		},
+		{
+			name: "backoff stops",
+			policy: RefreshRetryPolicy{
+				MaxAttempts: 10,
+				NewBackOff: func() backoff.BackOff {
+					return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 1)
+				},
+			},
+			refreshes: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			var refreshes atomic.Int32
+			srv := newNoIDTokenIdP(t, &refreshes)
+
+			c, err := NewOIDCClient(context.Background(), "client-id", srv.URL,
+				WithDiscoveryCache(NewDiscoveryCache("", 0)),
+				WithRefreshRetryPolicy(test.policy),
+			)
+			r.NoError(err)
+
+			existing := &Token{
+				IDToken: "existing-id-token",
+				Claims:  Claims{Email: "user@example.com"},
+				Token:   &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)},
+			}
+			token, err := c.refreshToken(context.Background(), existing)
+			r.NoError(err)
+			r.Equal("refreshed", token.AccessToken)
+			r.Equal("existing-id-token", token.IDToken)
+			r.Equal("user@example.com", token.Claims.Email)
+			r.Equal(test.refreshes, refreshes.Load())
+		})
+	}
+}
+
+func TestRefreshRetryPolicyContext(t *testing.T) {
+	r := require.New(t)
+	var refreshes atomic.Int32
+	srv := newNoIDTokenIdP(t, &refreshes)
+
+	c, err := NewOIDCClient(context.Background(), "client-id", srv.URL, WithDiscoveryCache(NewDiscoveryCache("", 0)))
+	r.NoError(err)
+	expired := func() *Token {
+		return &Token{
+			IDToken: "existing-id-token",
+			Token:   &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)},
+		}
+	}
+
+	// Reaching the context's deadline while waiting fails the refresh
+	// instead of keeping the existing ID token.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.refreshToken(ctx, expired())
+	r.ErrorIs(err, context.DeadlineExceeded)
+	r.Less(time.Since(start), 5*time.Second)
+	r.Equal(int32(1), refreshes.Load())
+
+	// Canceling the context while waiting aborts the refresh.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = c.refreshToken(ctx, expired())
+	r.ErrorIs(err, context.Canceled)
+	r.Less(time.Since(start), 5*time.Second)
+	r.Equal(int32(2), refreshes.Load())
+}
+
+func TestRefreshRetrierContextDone(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// even a policy accepting the missing ID token does not outlive the
+	// context
+	retrier := RefreshRetryPolicy{AcceptMissingIDToken: true}.start(ctx)
+	_, retry, err := retrier.next()
+	r.ErrorIs(err, context.Canceled)
+	r.False(retry)
+}
+
+func TestWithRefreshRetryPolicyValidation(t *testing.T) {
+	r := require.New(t)
+	c := &OIDCClient{}
+
+	r.Error(WithRefreshRetryPolicy(RefreshRetryPolicy{MaxAttempts: -1})(context.Background(), c))
+	r.Error(WithRefreshRetryPolicy(RefreshRetryPolicy{Deadline: -time.Second})(context.Background(), c))
+}
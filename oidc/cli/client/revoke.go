@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	tokenTypeHintAccessToken  = "access_token"
+	tokenTypeHintRefreshToken = "refresh_token"
+)
+
+// RevokeTokens discovers the issuer's revocation endpoint and revokes the
+// token's refresh token and access token (RFC 7009). The refresh token is
+// revoked first since it is the long-lived credential. It uses the default
+// discovery cache and HTTP client; use OIDCClient.RevokeTokens to honor
+// WithHTTPClient and WithDiscoveryCache.
+func RevokeTokens(ctx context.Context, clientID, issuerURL string, token *Token) error {
+	if !hasTokensToRevoke(token) {
+		return nil
+	}
+
+	revokeURL, err := discoverRevocationEndpoint(ctx, issuerURL)
+	if err != nil {
+		return fmt.Errorf("discovering revocation endpoint: %w", err)
+	}
+	return revokeTokens(ctx, revokeURL, clientID, nil, token)
+}
+
+// RevokeTokens revokes the token's refresh token and access token at the
+// issuer's revocation endpoint (RFC 7009), through the client's HTTP
+// client. A client configured with WithClientCredentialsAuthenticator
+// authenticates with its credentials.
+func (c *OIDCClient) RevokeTokens(ctx context.Context, token *Token) error {
+	if !hasTokensToRevoke(token) {
+		return nil
+	}
+	if c.metadata.RevocationEndpoint == "" {
+		return fmt.Errorf("discovering revocation endpoint: no revocation_endpoint in discovery document")
+	}
+	return revokeTokens(c.clientContext(ctx), c.metadata.RevocationEndpoint, c.ClientID, c.clientAuth(), token)
+}
+
+func hasTokensToRevoke(token *Token) bool {
+	return token != nil && token.Token != nil && (token.RefreshToken != "" || token.AccessToken != "")
+}
+
+// revokeTokens revokes the refresh token, then the access token,
+// authenticating with auth when set.
+func revokeTokens(ctx context.Context, revokeURL, clientID string, auth *ClientCredentialsAuthenticator, token *Token) error {
+	if token.RefreshToken != "" {
+		err := revokeToken(ctx, revokeURL, clientID, auth, token.RefreshToken, tokenTypeHintRefreshToken)
+		if err != nil {
+			return err
+		}
+	}
+	if token.AccessToken != "" {
+		err := revokeToken(ctx, revokeURL, clientID, auth, token.AccessToken, tokenTypeHintAccessToken)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeToken calls the OAuth 2.0 revocation endpoint (RFC 7009). The
+// endpoint responds 200 for invalid or already revoked tokens too.
+func revokeToken(ctx context.Context, revokeURL, clientID string, auth *ClientCredentialsAuthenticator, token, tokenTypeHint string) error {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {tokenTypeHint},
+	}
+
+	req, err := newClientRequest(ctx, revokeURL, clientID, auth, form)
+	if err != nil {
+		return fmt.Errorf("creating revocation request: %w", err)
+	}
+
+	resp, err := httpClientFromContext(ctx).Do(req)
+	if err != nil {
+		return fmt.Errorf("calling revocation endpoint: %w", idpRequestError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revocation endpoint returned %s for %s", resp.Status, tokenTypeHint)
+	}
+	return nil
+}
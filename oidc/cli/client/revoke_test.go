@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestDiscoverRevocationEndpointMissing(t *testing.T) {
+	r := require.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		r.NoError(json.NewEncoder(w).Encode(map[string]string{
+			"introspection_endpoint": "https://idp.example.com/oauth2/v1/introspect",
+		}))
+	}))
+	defer srv.Close()
+
+	_, err := discoverRevocationEndpoint(context.Background(), srv.URL)
+	r.Error(err)
+	r.Contains(err.Error(), "no revocation_endpoint")
+}
+
+func TestRevokeTokens(t *testing.T) {
+	r := require.New(t)
+
+	var hints []string
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		r.NoError(json.NewEncoder(w).Encode(map[string]string{
+			"revocation_endpoint": srv.URL + "/revoke",
+		}))
+	})
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, req *http.Request) {
+		r.Equal(http.MethodPost, req.Method)
+		r.Equal("application/x-www-form-urlencoded", req.Header.Get("Content-Type"))
+		r.NoError(req.ParseForm())
+		r.Equal("my-client-id", req.FormValue("client_id"))
+		hints = append(hints, req.FormValue("token_type_hint"))
+	})
+
+	err := RevokeTokens(context.Background(), "my-client-id", srv.URL, &Token{
+		Token: &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"},
+	})
+	r.NoError(err)
+	r.Equal([]string{"refresh_token", "access_token"}, hints)
+}
+
+func TestRevokeTokensServerError(t *testing.T) {
+	r := require.New(t)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		r.NoError(json.NewEncoder(w).Encode(map[string]string{
+			"revocation_endpoint": srv.URL + "/revoke",
+		}))
+	})
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	err := RevokeTokens(context.Background(), "client", srv.URL, &Token{
+		Token: &oauth2.Token{RefreshToken: "refresh"},
+	})
+	r.Error(err)
+	r.Contains(err.Error(), "400")
+}
+
+func TestOIDCClientRevokeAndIntrospectUseHTTPClient(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+				"issuer":                 srv.URL,
+				"token_endpoint":         srv.URL + "/token",
+				"introspection_endpoint": srv.URL + "/introspect",
+				"revocation_endpoint":    srv.URL + "/revoke",
+			})
+		case "/introspect":
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "exp": 1700000000}) //nolint:errcheck
+		case "/revoke":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	c, err := NewOIDCClient(ctx, "client-id", srv.URL,
+		WithDiscoveryCache(NewDiscoveryCache("", 0)),
+		WithHTTPClient(&http.Client{Transport: transport}),
+	)
+	r.NoError(err)
+	r.Equal(int32(1), transport.requests.Load())
+
+	err = c.RevokeTokens(ctx, &Token{Token: &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}})
+	r.NoError(err)
+	r.Equal(int32(3), transport.requests.Load())
+
+	expiry, err := c.LookupRefreshExpiry(ctx, "refresh")
+	r.NoError(err)
+	r.Equal(int64(1700000000), expiry.Unix())
+	r.Equal(int32(4), transport.requests.Load())
+}
+
+func TestOIDCClientRevokeAndIntrospectUseClientAuth(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	idp := newFakeIdP(t)
+
+	basic, err := NewClientSecretAuthenticator("s3cret", ClientSecretBasic)
+	r.NoError(err)
+	c := idp.client(t, WithClientCredentialsAuthenticator(basic))
+
+	r.NoError(c.RevokeTokens(ctx, &Token{Token: &oauth2.Token{RefreshToken: "refresh"}}))
+	req := idp.lastRequest(t, "/revoke")
+	user, pass, ok := req.BasicAuth()
+	r.True(ok)
+	r.Equal("client-id", user)
+	r.Equal("s3cret", pass)
+	r.Equal("refresh", req.PostForm.Get("token"))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	r.NoError(err)
+	jwtAuth, err := NewPrivateKeyJWTAuthenticator(key, "")
+	r.NoError(err)
+	c = idp.client(t, WithClientCredentialsAuthenticator(jwtAuth))
+
+	_, err = c.LookupRefreshExpiry(ctx, "refresh")
+	r.NoError(err)
+	form := idp.lastRequest(t, "/introspect").PostForm
+	r.Equal("client-id", form.Get("client_id"))
+	r.Equal(clientAssertionType, form.Get("client_assertion_type"))
+
+	claims := &jwt.RegisteredClaims{}
+	_, err = jwt.ParseWithClaims(form.Get("client_assertion"), claims, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	r.NoError(err)
+	r.True(claims.VerifyAudience(idp.URL+"/introspect", true))
+}
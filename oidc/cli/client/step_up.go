@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrAuthenticationRequirementNotMet is wrapped when a token's
+// authentication does not satisfy an AuthenticationRequirement.
+var ErrAuthenticationRequirementNotMet = errors.New("authentication requirement not met")
+
+// AuthenticationRequirement is how recently and strongly the user must
+// have authenticated, for commands that need a step-up login.
+type AuthenticationRequirement struct {
+	// ACRValues are requested with acr_values, in order of preference.
+	// The ID token's acr claim must be one of them.
+	ACRValues []string
+	// AMR are authentication methods (e.g. "hwk", "mfa") that must all be
+	// in the ID token's amr claim. They are enforced only, there is no
+	// standard parameter to request them.
+	AMR []string
+	// MaxAge is requested with max_age, and the ID token's auth_time must
+	// be at most this old. Zero means no limit.
+	MaxAge time.Duration
+}
+
+// WithAuthenticationRequirement requests req in authorization requests and
+// rejects tokens not satisfying it: RefreshToken replaces such a token by an
+// interactive login instead of refreshing it, and an interactive login that
+// doesn't satisfy req fails with ErrAuthenticationRequirementNotMet. A
+// successful refresh is returned as is, for the caller to check.
+func WithAuthenticationRequirement(req AuthenticationRequirement) OIDCClientOption {
+	return func(ctx context.Context, c *OIDCClient) error {
+		if req.MaxAge < 0 {
+			return fmt.Errorf("max age must not be negative, got %s", req.MaxAge)
+		}
+		c.requirement = &req
+		return nil
+	}
+}
+
+// authCodeOptions are the authorization request parameters asking for req.
+func (req *AuthenticationRequirement) authCodeOptions() []oauth2.AuthCodeOption {
+	if req == nil {
+		return nil
+	}
+	var opts []oauth2.AuthCodeOption
+	if len(req.ACRValues) > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("acr_values", strings.Join(req.ACRValues, " ")))
+	}
+	if req.MaxAge > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("max_age", strconv.Itoa(int(req.MaxAge.Seconds()))))
+	}
+	return opts
+}
+
+// Check returns an error wrapping ErrAuthenticationRequirementNotMet if
+// token's ID token claims don't satisfy req.
+func (req *AuthenticationRequirement) Check(token *Token) error {
+	if req == nil {
+		return nil
+	}
+	claims := token.Claims
+
+	if len(req.ACRValues) > 0 && !slices.Contains(req.ACRValues, claims.ACR) {
+		return fmt.Errorf("%w: acr %q is not one of %q", ErrAuthenticationRequirementNotMet, claims.ACR, req.ACRValues)
+	}
+	for _, method := range req.AMR {
+		if !slices.Contains(claims.AuthenticationMethods, method) {
+			return fmt.Errorf("%w: amr %q does not include %q", ErrAuthenticationRequirementNotMet, claims.AuthenticationMethods, method)
+		}
+	}
+	if req.MaxAge > 0 {
+		if claims.AuthTime == 0 {
+			return fmt.Errorf("%w: no auth_time in ID token", ErrAuthenticationRequirementNotMet)
+		}
+		age := time.Since(time.Unix(claims.AuthTime, 0))
+		if age > req.MaxAge {
+			return fmt.Errorf("%w: authenticated %s ago, more than %s", ErrAuthenticationRequirementNotMet, age.Truncate(time.Second), req.MaxAge)
+		}
+	}
+	return nil
+}
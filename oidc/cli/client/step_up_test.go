@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestAuthenticationRequirementCheck(t *testing.T) {
+	recent := time.Now().Add(-time.Minute).Unix()
+	stale := time.Now().Add(-time.Hour).Unix()
+	req := &AuthenticationRequirement{
+		ACRValues: []string{"phr", "phrh"},
+		AMR:       []string{"hwk", "mfa"},
+		MaxAge:    10 * time.Minute,
+	}
+
+	tests := []struct {
+		name   string
+		claims Claims
+		errMsg string
+	}{
+		{
+			name:   "satisfied",
+			claims: Claims{ACR: "phrh", AuthenticationMethods: []string{"pwd", "hwk", "mfa"}, AuthTime: recent},
+		},
+		{
+			name:   "wrong acr",
+			claims: Claims{ACR: "pwd", AuthenticationMethods: []string{"hwk", "mfa"}, AuthTime: recent},
+			errMsg: `acr "pwd"`,
+		},
+		{
+			name:   "missing amr",
+			claims: Claims{ACR: "phr", AuthenticationMethods: []string{"mfa"}, AuthTime: recent},
+			errMsg: `does not include "hwk"`,
+		},
+		{
+			name:   "too old",
+			claims: Claims{ACR: "phr", AuthenticationMethods: []string{"hwk", "mfa"}, AuthTime: stale},
+			errMsg: "more than 10m0s",
+		},
+		{
+			name:   "no auth_time",
+			claims: Claims{ACR: "phr", AuthenticationMethods: []string{"hwk", "mfa"}},
+			errMsg: "no auth_time",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			err := req.Check(&Token{Claims: test.claims, Token: &oauth2.Token{}})
+			if test.errMsg == "" {
+				r.NoError(err)
+				return
+			}
+			r.ErrorIs(err, ErrAuthenticationRequirementNotMet)
+			r.Contains(err.Error(), test.errMsg)
+		})
+	}
+
+	var none *AuthenticationRequirement
+	require.NoError(t, none.Check(&Token{Token: &oauth2.Token{}}))
+}
+
+func TestAuthenticationRequirementAuthCodeURL(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	c := idp.client(t, WithAuthenticationRequirement(AuthenticationRequirement{
+		ACRValues: []string{"phr", "phrh"},
+		MaxAge:    5 * time.Minute,
+	}))
+
+	material, err := newOauthMaterial()
+	r.NoError(err)
+	authURL, err := url.Parse(c.AuthCodeURL(material.State, authCodeURLOptions(c, material)...))
+	r.NoError(err)
+	r.Equal("phr phrh", authURL.Query().Get("acr_values"))
+	r.Equal("300", authURL.Query().Get("max_age"))
+	r.Equal(material.Nonce, authURL.Query().Get("nonce"))
+
+	_, err = NewOIDCClient(context.Background(), "client-id", idp.URL,
+		WithAuthenticationRequirement(AuthenticationRequirement{MaxAge: -time.Second}))
+	r.Error(err)
+}
+
+func TestRefreshTokenStepUp(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	ctx := context.Background()
+	req := WithAuthenticationRequirement(AuthenticationRequirement{AMR: []string{"hwk"}})
+
+	steppedUp := &fakeAuthenticator{token: &Token{
+		Claims: Claims{AuthenticationMethods: []string{"hwk"}},
+		Token:  &oauth2.Token{AccessToken: "stepped-up"},
+	}}
+	token, err := idp.client(t, req, withFakeAuthenticator(steppedUp)).RefreshToken(ctx, &Token{
+		Token: &oauth2.Token{RefreshToken: "valid-refresh"},
+	})
+	r.NoError(err)
+	r.Equal("stepped-up", token.AccessToken)
+	r.Equal(1, steppedUp.calls)
+	// refreshing would not have stepped the token up
+	r.Empty(idp.requests["/token"])
+
+	// the IdP ignored the requirement
+	weak := &fakeAuthenticator{token: &Token{
+		Claims: Claims{AuthenticationMethods: []string{"pwd"}},
+		Token:  &oauth2.Token{AccessToken: "weak"},
+	}}
+	_, err = idp.client(t, req, withFakeAuthenticator(weak)).RefreshToken(ctx, &Token{Token: &oauth2.Token{}})
+	r.ErrorIs(err, ErrAuthenticationRequirementNotMet)
+}
+
+func TestRefreshTokenKeepsRefreshedToken(t *testing.T) {
+	r := require.New(t)
+	idp := newFakeIdP(t)
+	interactive := &fakeAuthenticator{token: &Token{Token: &oauth2.Token{AccessToken: "interactive"}}}
+	c := idp.client(t,
+		WithAuthenticationRequirement(AuthenticationRequirement{AMR: []string{"hwk"}}),
+		withFakeAuthenticator(interactive),
+	)
+
+	// the IdP's refreshed ID token has no amr, it is up to the caller to
+	// reject it
+	token, err := c.RefreshToken(context.Background(), &Token{
+		Claims: Claims{AuthenticationMethods: []string{"hwk"}},
+		Token:  &oauth2.Token{RefreshToken: "valid-refresh"},
+	})
+	r.NoError(err)
+	r.Equal("user@example.com", token.Claims.Email)
+	r.ErrorIs(c.requirement.Check(token), ErrAuthenticationRequirementNotMet)
+	r.Equal(0, interactive.calls)
+}
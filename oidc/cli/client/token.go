@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -15,13 +16,197 @@ const (
 
 // Claims represent the oidc token claims
 type Claims struct {
-	Issuer                string   `json:"iss"`
+	Issuer string `json:"iss"`
+	// Audience is the first aud value, see Audiences for all of them.
 	Audience              string   `json:"aud"`
 	Subject               string   `json:"sub"`
 	Name                  string   `json:"name"`
 	AuthenticationMethods []string `json:"amr"`
 	Email                 string   `json:"email"`
 	PreferredUsername     string   `json:"preferred_username"`
+	Groups                []string `json:"groups,omitempty"`
+	// Audiences holds every aud value, which may be a single string or
+	// an array of strings.
+	Audiences []string `json:"-"`
+
+	// ACR and AuthTime (seconds since the epoch) describe how and when
+	// the user authenticated, see AuthenticationRequirement.
+	ACR      string `json:"acr,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+
+	// Raw holds every claim of the ID token, including custom claims
+	// without a field above. It is preserved through Marshal and
+	// TokenFromString.
+	Raw map[string]interface{} `json:"-"`
+}
+
+// claimsFields is Claims without its JSON methods.
+type claimsFields Claims
+
+// UnmarshalJSON implements json.Unmarshaler, populating both the typed
+// fields and Raw.
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	var wire struct {
+		*claimsFields
+		Audience Audience `json:"aud"`
+		// some IdPs send a single group as a string
+		Groups Audience `json:"groups"`
+	}
+	fields := claimsFields{}
+	wire.claimsFields = &fields
+	err := json.Unmarshal(data, &wire)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]interface{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	*c = Claims(fields)
+	if len(wire.Audience) > 0 {
+		c.Audience = wire.Audience[0]
+		c.Audiences = wire.Audience
+	}
+	c.Groups = wire.Groups
+	c.Raw = raw
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The typed fields take precedence
+// over the same claims in Raw.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(claimsFields(c))
+	if err != nil || (len(c.Raw) == 0 && len(c.Audiences) <= 1) {
+		return data, err
+	}
+
+	merged := map[string]interface{}{}
+	err = json.Unmarshal(data, &merged)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Audiences) > 1 {
+		merged["aud"] = c.Audiences
+	}
+	for k, v := range c.Raw {
+		if _, ok := merged[k]; !ok {
+			merged[k] = v
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// Claim returns the raw value of the named claim.
+func (c *Claims) Claim(name string) (interface{}, bool) {
+	v, ok := c.Raw[name]
+	return v, ok
+}
+
+// StringClaim returns the named claim if it is a string.
+func (c *Claims) StringClaim(name string) (string, bool) {
+	v, ok := c.Raw[name].(string)
+	return v, ok
+}
+
+// StringsClaim returns the named claim if it is a string or an array of
+// strings.
+func (c *Claims) StringsClaim(name string) ([]string, bool) {
+	switch v := c.Raw[name].(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, elem := range v {
+			s, ok := elem.(string)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, s)
+		}
+		return values, true
+	default:
+		return nil, false
+	}
+}
+
+// BoolClaim returns the named claim if it is a boolean.
+func (c *Claims) BoolClaim(name string) (bool, bool) {
+	v, ok := c.Raw[name].(bool)
+	return v, ok
+}
+
+// DecodeClaim unmarshals the named claim into v.
+func (c *Claims) DecodeClaim(name string, v interface{}) error {
+	raw, ok := c.Raw[name]
+	if !ok {
+		return fmt.Errorf("claim %q not present", name)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("marshalling claim %q: %w", name, err)
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("unmarshalling claim %q: %w", name, err)
+	}
+	return nil
+}
+
+// InGroup reports whether group is one of the groups claim values.
+func (c *Claims) InGroup(group string) bool {
+	for _, g := range c.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Audience is the aud claim, which may be either a single string or an
+// array of strings.
+type Audience []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single == "" {
+			*a = nil
+		} else {
+			*a = Audience{single}
+		}
+		return nil
+	}
+
+	var multi []string
+	err := json.Unmarshal(data, &multi)
+	if err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings: %w", err)
+	}
+	*a = multi
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding a single audience as a
+// string.
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Contains reports whether aud is one of the audiences.
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
 }
 
 // Token wraps the extracted claims, auth token, id token, refresh token
@@ -34,6 +219,33 @@ type Token struct {
 	RefreshTokenExpiry *time.Time `json:"refresh_token_expiry,omitempty"`
 }
 
+// IDTokenExpiry returns the exp claim of the ID token, which may differ
+// from the access token's Expiry. The ID token was verified when it was
+// obtained, so its signature is not checked again.
+func (vt *Token) IDTokenExpiry() (time.Time, bool) {
+	parts := strings.Split(vt.IDToken, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return time.Time{}, false
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil || exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
 func TokenFromString(tokenString *string, opts ...MarshalOpts) (*Token, error) {
 	if tokenString == nil {
 		return &Token{Token: &oauth2.Token{}}, nil
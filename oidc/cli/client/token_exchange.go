@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// Token type identifiers from RFC 8693 section 3.
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+
+	// defaultExchangedTokenLifetime is assumed for exchanged tokens whose
+	// response has no expires_in, which would otherwise never expire.
+	defaultExchangedTokenLifetime = 5 * time.Minute
+)
+
+// TokenExchangeRequest is an OAuth 2.0 Token Exchange request (RFC 8693).
+type TokenExchangeRequest struct {
+	SubjectToken     string
+	SubjectTokenType string
+	// Audience is the logical name of the target service.
+	Audience string
+	Scopes   []string
+	// RequestedTokenType defaults to the IdP's choice, usually an
+	// access token.
+	RequestedTokenType string
+}
+
+// NewTokenExchangeRequest exchanges subject's ID token, or its access token
+// if it has no ID token, for a token restricted to audience.
+func NewTokenExchangeRequest(subject *Token, audience string) (*TokenExchangeRequest, error) {
+	if subject == nil || subject.Token == nil {
+		return nil, fmt.Errorf("cannot exchange nil token")
+	}
+
+	req := &TokenExchangeRequest{Audience: audience}
+	switch {
+	case subject.IDToken != "":
+		req.SubjectToken = subject.IDToken
+		req.SubjectTokenType = TokenTypeIDToken
+	case subject.AccessToken != "":
+		req.SubjectToken = subject.AccessToken
+		req.SubjectTokenType = TokenTypeAccessToken
+	default:
+		return nil, fmt.Errorf("token has neither an id token nor an access token to exchange")
+	}
+	return req, nil
+}
+
+// tokenExchangeResponse is the token endpoint's response to a token
+// exchange request.
+type tokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope"`
+	RefreshToken    string `json:"refresh_token"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// ExchangeToken exchanges a token at the token endpoint using the
+// urn:ietf:params:oauth:grant-type:token-exchange grant (RFC 8693). A
+// confidential client configured with WithClientCredentialsAuthenticator
+// authenticates with its secret or private_key_jwt assertion; otherwise
+// only client_id is sent. A token issued without expires_in is given a
+// lifetime of 5 minutes, so it isn't cached forever.
+func (c *OIDCClient) ExchangeToken(ctx context.Context, exchange *TokenExchangeRequest) (*Token, error) {
+	ctx = c.clientContext(ctx)
+
+	form := url.Values{
+		"grant_type":         {grantTypeTokenExchange},
+		"subject_token":      {exchange.SubjectToken},
+		"subject_token_type": {exchange.SubjectTokenType},
+	}
+	if exchange.Audience != "" {
+		form.Set("audience", exchange.Audience)
+	}
+	if len(exchange.Scopes) > 0 {
+		form.Set("scope", strings.Join(exchange.Scopes, " "))
+	}
+	if exchange.RequestedTokenType != "" {
+		form.Set("requested_token_type", exchange.RequestedTokenType)
+	}
+
+	req, err := newClientRequest(ctx, c.Endpoint.TokenURL, c.ClientID, c.clientAuth(), form)
+	if err != nil {
+		return nil, fmt.Errorf("creating token exchange request: %w", err)
+	}
+
+	c.log.Debug("OIDCClient.ExchangeToken: exchanging token",
+		"audience", exchange.Audience,
+		"subject_token_type", exchange.SubjectTokenType,
+	)
+
+	resp, err := httpClientFromContext(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling token endpoint: %w", idpRequestError(err))
+	}
+	defer resp.Body.Close()
+
+	body := &tokenExchangeResponse{}
+	err = json.NewDecoder(resp.Body).Decode(body)
+	if resp.StatusCode != http.StatusOK {
+		if err == nil && body.Error != "" {
+			return nil, fmt.Errorf("token exchange failed: %s: %s", body.Error, body.ErrorDescription)
+		}
+		if isGatewayFailure(resp.StatusCode) {
+			return nil, fmt.Errorf("%w: token endpoint returned %s", ErrIdPUnreachable, resp.Status)
+		}
+		return nil, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding token exchange response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange response has no access_token")
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  body.AccessToken,
+		TokenType:    body.TokenType,
+		RefreshToken: body.RefreshToken,
+	}
+	lifetime := defaultExchangedTokenLifetime
+	if body.ExpiresIn > 0 {
+		lifetime = time.Duration(body.ExpiresIn) * time.Second
+	}
+	token.Expiry = time.Now().Add(lifetime)
+
+	c.log.Debug("OIDCClient.ExchangeToken: completed",
+		"issued_token_type", body.IssuedTokenType,
+		"token_expiry", token.Expiry,
+	)
+	exchanged := &Token{Token: token}
+	if exchange.Audience != "" {
+		exchanged.Claims.Audience = exchange.Audience
+		exchanged.Claims.Audiences = []string{exchange.Audience}
+	}
+	return exchanged, nil
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestNewTokenExchangeRequest(t *testing.T) {
+	r := require.New(t)
+
+	req, err := NewTokenExchangeRequest(&Token{IDToken: "id", Token: &oauth2.Token{AccessToken: "access"}}, "api")
+	r.NoError(err)
+	r.Equal("id", req.SubjectToken)
+	r.Equal(TokenTypeIDToken, req.SubjectTokenType)
+
+	req, err = NewTokenExchangeRequest(&Token{Token: &oauth2.Token{AccessToken: "access"}}, "api")
+	r.NoError(err)
+	r.Equal("access", req.SubjectToken)
+	r.Equal(TokenTypeAccessToken, req.SubjectTokenType)
+
+	_, err = NewTokenExchangeRequest(&Token{Token: &oauth2.Token{}}, "api")
+	r.Error(err)
+}
+
+func TestExchangeToken(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	idp := newFakeIdP(t)
+	c := idp.client(t)
+
+	token, err := c.ExchangeToken(ctx, &TokenExchangeRequest{
+		SubjectToken:     "id",
+		SubjectTokenType: TokenTypeIDToken,
+		Audience:         "api://downstream",
+		Scopes:           []string{"read", "write"},
+	})
+	r.NoError(err)
+	r.Equal("api://downstream:"+TokenTypeIDToken+":read write", token.AccessToken)
+	r.Equal("api://downstream", token.Claims.Audience)
+	r.WithinDuration(time.Now().Add(10*time.Minute), token.Expiry, 5*time.Second)
+
+	form := idp.lastTokenRequest(t).PostForm
+	r.Equal(grantTypeTokenExchange, form.Get("grant_type"))
+	r.Equal("client-id", form.Get("client_id"))
+	r.Equal("id", form.Get("subject_token"))
+	r.Empty(form.Get("client_secret"))
+
+	// without expires_in the token still expires
+	token, err = c.ExchangeToken(ctx, &TokenExchangeRequest{
+		SubjectToken:     "id",
+		SubjectTokenType: TokenTypeIDToken,
+		Audience:         "no-expiry",
+	})
+	r.NoError(err)
+	r.WithinDuration(time.Now().Add(defaultExchangedTokenLifetime), token.Expiry, 5*time.Second)
+
+	_, err = c.ExchangeToken(ctx, &TokenExchangeRequest{
+		SubjectToken:     "id",
+		SubjectTokenType: TokenTypeIDToken,
+		Audience:         "forbidden",
+	})
+	r.Error(err)
+	r.Contains(err.Error(), "invalid_target: audience not allowed")
+}
+
+func TestExchangeTokenClientAuth(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	idp := newFakeIdP(t)
+	exchange := &TokenExchangeRequest{
+		SubjectToken:     "id",
+		SubjectTokenType: TokenTypeIDToken,
+		Audience:         "api",
+	}
+
+	post, err := NewClientSecretAuthenticator("s3cret", ClientSecretPost)
+	r.NoError(err)
+	_, err = idp.client(t, WithClientCredentialsAuthenticator(post)).ExchangeToken(ctx, exchange)
+	r.NoError(err)
+	r.Equal("s3cret", idp.lastTokenRequest(t).PostForm.Get("client_secret"))
+
+	basic, err := NewClientSecretAuthenticator("s3cret", ClientSecretBasic)
+	r.NoError(err)
+	_, err = idp.client(t, WithClientCredentialsAuthenticator(basic)).ExchangeToken(ctx, exchange)
+	r.NoError(err)
+	req := idp.lastTokenRequest(t)
+	user, pass, ok := req.BasicAuth()
+	r.True(ok)
+	r.Equal("client-id", user)
+	r.Equal("s3cret", pass)
+	r.Empty(req.PostForm.Get("client_secret"))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	r.NoError(err)
+	jwtAuth, err := NewPrivateKeyJWTAuthenticator(key, "")
+	r.NoError(err)
+	_, err = idp.client(t, WithClientCredentialsAuthenticator(jwtAuth)).ExchangeToken(ctx, exchange)
+	r.NoError(err)
+	form := idp.lastTokenRequest(t).PostForm
+	r.Equal(clientAssertionType, form.Get("client_assertion_type"))
+	r.NotEmpty(form.Get("client_assertion"))
+}
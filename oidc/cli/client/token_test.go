@@ -0,0 +1,135 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+const testClaims = `{
+	"iss": "https://issuer.example.com",
+	"aud": ["client-id", "api://default"],
+	"sub": "user",
+	"email": "user@example.com",
+	"groups": ["admins", "developers"],
+	"department": "engineering",
+	"roles": ["reader"],
+	"mfa": true,
+	"tenant": {"id": "t1"}
+}`
+
+func TestClaimsUnmarshal(t *testing.T) {
+	r := require.New(t)
+
+	claims := &Claims{}
+	r.NoError(json.Unmarshal([]byte(testClaims), claims))
+	r.Equal("client-id", claims.Audience)
+	r.Equal([]string{"client-id", "api://default"}, claims.Audiences)
+	r.Equal([]string{"admins", "developers"}, claims.Groups)
+	r.True(claims.InGroup("admins"))
+	r.False(claims.InGroup("ops"))
+
+	dept, ok := claims.StringClaim("department")
+	r.True(ok)
+	r.Equal("engineering", dept)
+
+	roles, ok := claims.StringsClaim("roles")
+	r.True(ok)
+	r.Equal([]string{"reader"}, roles)
+
+	mfa, ok := claims.BoolClaim("mfa")
+	r.True(ok)
+	r.True(mfa)
+
+	_, ok = claims.StringClaim("missing")
+	r.False(ok)
+
+	var tenant struct {
+		ID string `json:"id"`
+	}
+	r.NoError(claims.DecodeClaim("tenant", &tenant))
+	r.Equal("t1", tenant.ID)
+	r.Error(claims.DecodeClaim("missing", &tenant))
+}
+
+func TestClaimsSingleValues(t *testing.T) {
+	r := require.New(t)
+
+	claims := &Claims{}
+	r.NoError(json.Unmarshal([]byte(`{"aud": "client-id", "groups": "admins"}`), claims))
+	r.Equal("client-id", claims.Audience)
+	r.Equal([]string{"client-id"}, claims.Audiences)
+	r.Equal([]string{"admins"}, claims.Groups)
+
+	data, err := json.Marshal(claims)
+	r.NoError(err)
+	r.Contains(string(data), `"aud":"client-id"`)
+}
+
+func TestClaimsRoundTrip(t *testing.T) {
+	r := require.New(t)
+
+	claims := Claims{}
+	r.NoError(json.Unmarshal([]byte(testClaims), &claims))
+	claims.Email = "changed@example.com"
+
+	b64, err := (&Token{Token: &oauth2.Token{AccessToken: "access"}, Claims: claims}).Marshal()
+	r.NoError(err)
+
+	token, err := TokenFromString(&b64)
+	r.NoError(err)
+	r.Equal("changed@example.com", token.Claims.Email)
+	r.Equal([]string{"admins", "developers"}, token.Claims.Groups)
+	r.Equal(claims.Audience, token.Claims.Audience)
+	r.Equal(claims.Audiences, token.Claims.Audiences)
+
+	dept, ok := token.Claims.StringClaim("department")
+	r.True(ok)
+	r.Equal("engineering", dept)
+	email, _ := token.Claims.StringClaim("email")
+	r.Equal("changed@example.com", email)
+}
+
+func TestTokenFromStringLegacyClaims(t *testing.T) {
+	r := require.New(t)
+
+	// tokens cached before Claims.Raw existed
+	legacy := `{"Version":0,"access_token":"access","claims":{"iss":"https://issuer.example.com","aud":"client-id","email":"user@example.com"}}`
+	b64 := base64.StdEncoding.EncodeToString([]byte(legacy))
+
+	token, err := TokenFromString(&b64)
+	r.NoError(err)
+	r.Equal("client-id", token.Claims.Audience)
+	r.Equal("user@example.com", token.Claims.Email)
+	r.Empty(token.Claims.Groups)
+}
+
+func TestTokenIDTokenExpiry(t *testing.T) {
+	r := require.New(t)
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user","exp":1700000000}`))
+	token := &Token{IDToken: "e30." + payload + ".sig"}
+	expiry, ok := token.IDTokenExpiry()
+	r.True(ok)
+	r.Equal(int64(1700000000), expiry.Unix())
+
+	for _, idToken := range []string{"", "not-a-jwt", "e30.!!!.sig", "e30." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + ".sig"} {
+		_, ok = (&Token{IDToken: idToken}).IDTokenExpiry()
+		r.False(ok, idToken)
+	}
+}
+
+func TestClaimsAudienceSetInCode(t *testing.T) {
+	r := require.New(t)
+
+	data, err := json.Marshal(Claims{Audience: "client-id"})
+	r.NoError(err)
+	r.Contains(string(data), `"aud":"client-id"`)
+
+	data, err = json.Marshal(Claims{Audience: "a", Audiences: []string{"a", "b"}})
+	r.NoError(err)
+	r.Contains(string(data), `"aud":["a","b"]`)
+}
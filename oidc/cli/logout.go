@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/cache"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+	"github.com/chanzuckerberg/go-misc/pidlock"
+)
+
+// Logout ends the session for clientID and issuerURL. It revokes the cached
+// refresh and access tokens at the IdP (RFC 7009), deletes the cache entry
+// from the active storage backend and, when a local cache dir is in use,
+// the root cache, then removes the lock file. Tokens cached by
+// GetExchangedToken are revoked and deleted the same way. The cache is
+// cleared even if revocation fails; all errors encountered are returned
+// joined together.
+func Logout(
+	ctx context.Context,
+	clientID string,
+	issuerURL string,
+	opts ...GetTokenOption,
+) error {
+	var cfg getTokenConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	ctx, logger := logging.NewLogger(ctx)
+	logger.Debug("Logout: started",
+		"client_id", clientID,
+		"issuer_url", issuerURL,
+	)
+
+	storageBackend, err := cfg.getStorage(ctx, clientID, issuerURL, cfg.fileOptions...)
+	if err != nil {
+		return fmt.Errorf("getting storage backend: %w", err)
+	}
+	backends := []storage.Storage{storageBackend}
+
+	if cfg.localCacheDir != "" {
+		rootStorage, err := cfg.getStorage(ctx, clientID, issuerURL, cfg.rootFileOptions...)
+		if err != nil {
+			return fmt.Errorf("getting root storage backend: %w", err)
+		}
+		backends = append(backends, rootStorage)
+	}
+
+	clientOptions, err := cfg.oidcClientOptions()
+	if err != nil {
+		return err
+	}
+	oidcClient := lazyOIDCClient(clientID, issuerURL, clientOptions)
+
+	errs := lockedLogout(clientID, issuerURL, cfg.localCacheDir, func() []error {
+		return logoutBackends(ctx, oidcClient, backends)
+	})
+	// the user's token is gone, so no new exchanged tokens can be cached
+	// once these are cleared
+	errs = append(errs, logoutExchanges(ctx, &cfg, clientID, issuerURL, oidcClient)...)
+
+	logger.Debug("Logout: completed", "errors", len(errs))
+	return errors.Join(errs...)
+}
+
+// lockedLogout runs logout holding the refresh lock of cacheID, so a
+// concurrent refresh can't write a new token back after it is deleted, and
+// removes the lock file afterwards.
+func lockedLogout(cacheID, issuerURL, localCacheDir string, logout func() []error) []error {
+	lockPath, err := lockFilePath(cacheID, issuerURL, localCacheDir)
+	if err != nil {
+		return []error{fmt.Errorf("getting lock file path: %w", err)}
+	}
+	fileLock, err := pidlock.NewLock(lockPath)
+	if err != nil {
+		return []error{fmt.Errorf("creating lock: %w", err)}
+	}
+
+	err = cache.AcquireLock(fileLock)
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := logout()
+
+	err = fileLock.Unlock()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	err = os.Remove(lockPath)
+	if err != nil && !os.IsNotExist(err) {
+		errs = append(errs, fmt.Errorf("removing lock file: %w", err))
+	}
+	return errs
+}
+
+// logoutExchanges revokes and deletes the exchanged tokens of every
+// audience recorded by GetExchangedToken, then the record itself.
+func logoutExchanges(
+	ctx context.Context,
+	cfg *getTokenConfig,
+	clientID string,
+	issuerURL string,
+	oidcClient func(context.Context) (*client.OIDCClient, error),
+) []error {
+	audiencesStorage, audiences, err := exchangeAudiences(ctx, cfg, clientID, issuerURL)
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, audience := range audiences {
+		cacheID := exchangeCacheID(clientID, audience)
+		backend, err := cfg.getStorage(ctx, cacheID, issuerURL, cfg.fileOptions...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("getting storage backend for audience %s: %w", audience, err))
+			continue
+		}
+		errs = append(errs, lockedLogout(cacheID, issuerURL, cfg.localCacheDir, func() []error {
+			return logoutBackends(ctx, oidcClient, []storage.Storage{backend})
+		})...)
+	}
+
+	return append(errs, lockedLogout(exchangeAudiencesID(clientID), issuerURL, cfg.localCacheDir, func() []error {
+		err := audiencesStorage.Delete(ctx)
+		if err != nil {
+			return []error{fmt.Errorf("deleting exchanged token audiences: %w", err)}
+		}
+		return nil
+	})...)
+}
+
+// logoutBackends revokes the token held by each backend, skipping tokens
+// already revoked, and deletes it from the backend. The OIDC client is only
+// created if there is a token to revoke.
+func logoutBackends(
+	ctx context.Context,
+	oidcClient func(context.Context) (*client.OIDCClient, error),
+	backends []storage.Storage,
+) []error {
+	logger := logging.FromContext(ctx)
+
+	var errs []error
+	revoked := map[string]bool{}
+	for _, backend := range backends {
+		token, err := cache.NewCache(ctx, backend, nil, nil).DecodeFromStorage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reading cached token: %w", err))
+		} else {
+			key := token.RefreshToken + " " + token.AccessToken
+			if !revoked[key] && (token.RefreshToken != "" || token.AccessToken != "") {
+				revoked[key] = true
+				err = revokeTokens(ctx, oidcClient, token)
+				if err != nil {
+					logger.Warn("Logout: failed to revoke tokens", "error", err)
+					errs = append(errs, fmt.Errorf("revoking tokens: %w", err))
+				}
+			}
+		}
+
+		err = backend.Delete(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deleting cached token: %w", err))
+		}
+	}
+	return errs
+}
+
+// revokeTokens revokes token with the OIDC client, creating it if needed.
+func revokeTokens(ctx context.Context, oidcClient func(context.Context) (*client.OIDCClient, error), token *client.Token) error {
+	c, err := oidcClient(ctx)
+	if err != nil {
+		return err
+	}
+	return c.RevokeTokens(ctx, token)
+}
@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+type fakeRevocationServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	revoked map[string]string
+}
+
+func (f *fakeRevocationServer) revokedTokens() map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.revoked
+}
+
+// newFakeRevocationServer serves a discovery document and an RFC 7009
+// revocation endpoint that records revoked tokens by token_type_hint. Its
+// token endpoint exchanges tokens for "<audience>:<subject_token>".
+func newFakeRevocationServer(t *testing.T) *fakeRevocationServer {
+	t.Helper()
+	f := &fakeRevocationServer{revoked: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+			"issuer":              f.URL,
+			"token_endpoint":      f.URL + "/token",
+			"revocation_endpoint": f.URL + "/revoke",
+		})
+	})
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.revoked[req.FormValue("token_type_hint")] = req.FormValue("token")
+		f.mu.Unlock()
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+			"access_token": req.FormValue("audience") + ":" + req.FormValue("subject_token"),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestLogout(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	localDir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+
+	idp := newFakeRevocationServer(t)
+	clientID := uuid.NewString()
+
+	s := storage.NewMemory(ctx, clientID, idp.URL)
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{
+			AccessToken:  "my-access-token",
+			RefreshToken: "my-refresh-token",
+			Expiry:       time.Now().Add(time.Hour),
+		},
+	})
+
+	lockPath, err := lockFilePath(clientID, idp.URL, localDir)
+	r.NoError(err)
+	r.NoError(os.WriteFile(lockPath, nil, 0600))
+
+	err = Logout(ctx, clientID, idp.URL, WithStorage(storage.BackendMemory), WithLocalCacheDir(localDir))
+	r.NoError(err)
+
+	r.Equal(map[string]string{
+		"refresh_token": "my-refresh-token",
+		"access_token":  "my-access-token",
+	}, idp.revokedTokens())
+
+	got, err := s.Read(ctx)
+	r.NoError(err)
+	r.Nil(got)
+
+	_, err = os.Stat(lockPath)
+	r.True(os.IsNotExist(err), "lock file should be removed")
+}
+
+func TestLogoutClearsExchangedTokens(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	idp := newFakeRevocationServer(t)
+	clientID := uuid.NewString()
+	storeToken(t, storage.NewMemory(ctx, clientID, idp.URL), &client.Token{
+		IDToken: "user-id-token",
+		Token:   &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	opts := []GetTokenOption{WithStorage(storage.BackendMemory)}
+	token, err := GetExchangedToken(ctx, clientID, idp.URL, "api", opts...)
+	r.NoError(err)
+	r.Equal("api:user-id-token", token.AccessToken)
+
+	r.NoError(Logout(ctx, clientID, idp.URL, opts...))
+	r.Equal("api:user-id-token", idp.revokedTokens()["access_token"])
+
+	for _, cacheID := range []string{exchangeCacheID(clientID, "api"), exchangeAudiencesID(clientID)} {
+		got, err := storage.NewMemory(ctx, cacheID, idp.URL).Read(ctx)
+		r.NoError(err)
+		r.Nil(got, "%s should be deleted", cacheID)
+
+		lockPath, err := lockFilePath(cacheID, idp.URL, "")
+		r.NoError(err)
+		_, err = os.Stat(lockPath)
+		r.True(os.IsNotExist(err), "lock file should be removed")
+	}
+}
+
+func TestLogoutClearsCacheWhenRevocationFails(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer idp.Close()
+	clientID := uuid.NewString()
+
+	s := storage.NewMemory(ctx, clientID, idp.URL)
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	err := Logout(ctx, clientID, idp.URL, WithStorage(storage.BackendMemory))
+	r.Error(err)
+	r.Contains(err.Error(), "revoking tokens")
+
+	got, err := s.Read(ctx)
+	r.NoError(err)
+	r.Nil(got)
+}
+
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.urls = append(rt.urls, req.URL.Path)
+	rt.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestLogoutUsesClientOptions(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	idp := newFakeRevocationServer(t)
+	clientID := uuid.NewString()
+	storeToken(t, storage.NewMemory(ctx, clientID, idp.URL), &client.Token{
+		Token: &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	transport := &recordingTransport{}
+	err := Logout(ctx, clientID, idp.URL,
+		WithStorage(storage.BackendMemory),
+		WithClientOptions(client.WithHTTPClient(&http.Client{Transport: transport})),
+	)
+	r.NoError(err)
+	r.Equal(map[string]string{"access_token": "access"}, idp.revokedTokens())
+	r.Contains(transport.urls, "/revoke")
+}
@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ProfileEnvVar selects the profile used when none is passed explicitly.
+	ProfileEnvVar = "OIDC_CLI_PROFILE"
+	// ProfilesFileEnvVar overrides the location of the profiles file.
+	ProfilesFileEnvVar = "OIDC_CLI_PROFILES_FILE"
+
+	profilesFileName = "profiles.yaml"
+)
+
+// Profile is a named OIDC client configuration.
+type Profile struct {
+	Name          string   `yaml:"-"`
+	ClientID      string   `yaml:"client_id"`
+	IssuerURL     string   `yaml:"issuer_url"`
+	Scopes        []string `yaml:"scopes,omitempty"`
+	LocalCacheDir string   `yaml:"local_cache_dir,omitempty"`
+}
+
+// profilesConfig is the on-disk format of the profiles file.
+type profilesConfig struct {
+	Default  string              `yaml:"default,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// ProfilesFile returns the path of the profiles file: OIDC_CLI_PROFILES_FILE
+// if set, otherwise profiles.yaml in storage.DefaultStorageDir.
+func ProfilesFile() (string, error) {
+	if path := os.Getenv(ProfilesFileEnvVar); path != "" {
+		return path, nil
+	}
+	dir, err := storage.DefaultStorageDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, profilesFileName), nil
+}
+
+func readProfiles() (*profilesConfig, error) {
+	path, err := ProfilesFile()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &profilesConfig{Profiles: map[string]*Profile{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading profiles file: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("parsing profiles file %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	for name, p := range cfg.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("profile %q in %s is empty", name, path)
+		}
+		p.Name = name
+	}
+	return cfg, nil
+}
+
+// ListProfiles returns all configured profiles sorted by name.
+func ListProfiles() ([]Profile, error) {
+	cfg, err := readProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]Profile, 0, len(cfg.Profiles))
+	for _, p := range cfg.Profiles {
+		profiles = append(profiles, *p)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles, nil
+}
+
+// GetProfile returns the named profile. An empty name resolves to
+// OIDC_CLI_PROFILE, then to the default profile in the profiles file.
+func GetProfile(name string) (*Profile, error) {
+	cfg, err := readProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = os.Getenv(ProfileEnvVar)
+	}
+	if name == "" {
+		name = cfg.Default
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no profile specified and no default profile configured")
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found", name)
+	}
+	if p.ClientID == "" || p.IssuerURL == "" {
+		return nil, fmt.Errorf("profile %q must set client_id and issuer_url", name)
+	}
+	return p, nil
+}
+
+// SaveProfile adds or replaces a profile in the profiles file. If
+// makeDefault is set, it also becomes the default profile.
+func SaveProfile(p Profile, makeDefault bool) error {
+	if p.Name == "" {
+		return fmt.Errorf("profile name must not be empty")
+	}
+
+	cfg, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	cfg.Profiles[p.Name] = &p
+	if makeDefault {
+		cfg.Default = p.Name
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshalling profiles: %w", err)
+	}
+
+	path, err := ProfilesFile()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("creating profiles dir: %w", err)
+	}
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("writing profiles file: %w", err)
+	}
+	return nil
+}
+
+// options converts the profile into GetTokenOptions.
+func (p *Profile) options() []GetTokenOption {
+	var opts []GetTokenOption
+	if len(p.Scopes) > 0 {
+		opts = append(opts, WithClientOptions(client.WithScopes(p.Scopes)))
+	}
+	if p.LocalCacheDir != "" {
+		opts = append(opts, WithLocalCacheDir(p.LocalCacheDir))
+	}
+	return opts
+}
+
+// GetTokenForProfile gets an oidc token for the named profile. See
+// GetProfile for how an empty name is resolved. opts are applied after
+// the profile's own settings.
+func GetTokenForProfile(ctx context.Context, profile string, opts ...GetTokenOption) (*client.Token, error) {
+	p, err := GetProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	return GetToken(ctx, p.ClientID, p.IssuerURL, append(p.options(), opts...)...)
+}
+
+// LogoutProfile logs out of the named profile. See Logout.
+func LogoutProfile(ctx context.Context, profile string, opts ...GetTokenOption) error {
+	p, err := GetProfile(profile)
+	if err != nil {
+		return err
+	}
+	return Logout(ctx, p.ClientID, p.IssuerURL, append(p.options(), opts...)...)
+}
+
+// StatusForProfile reports the cached login of the named profile. See
+// Status.
+func StatusForProfile(ctx context.Context, profile string, opts ...GetTokenOption) (*StatusReport, error) {
+	p, err := GetProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	return Status(ctx, p.ClientID, p.IssuerURL, append(p.options(), opts...)...)
+}
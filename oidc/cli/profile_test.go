@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+const testProfiles = `
+default: staging
+profiles:
+  staging:
+    client_id: staging-client
+    issuer_url: https://staging.example.com
+  prod:
+    client_id: prod-client
+    issuer_url: https://prod.example.com
+    scopes: [openid, email]
+`
+
+func setupProfiles(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	t.Setenv(ProfilesFileEnvVar, path)
+	t.Setenv(ProfileEnvVar, "")
+	if contents != "" {
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	}
+	return path
+}
+
+func TestListProfiles(t *testing.T) {
+	r := require.New(t)
+	setupProfiles(t, testProfiles)
+
+	profiles, err := ListProfiles()
+	r.NoError(err)
+	r.Len(profiles, 2)
+	r.Equal("prod", profiles[0].Name)
+	r.Equal([]string{"openid", "email"}, profiles[0].Scopes)
+	r.Equal("staging", profiles[1].Name)
+	r.Equal("staging-client", profiles[1].ClientID)
+}
+
+func TestListProfilesMissingFile(t *testing.T) {
+	r := require.New(t)
+	setupProfiles(t, "")
+
+	profiles, err := ListProfiles()
+	r.NoError(err)
+	r.Empty(profiles)
+}
+
+func TestGetProfileResolution(t *testing.T) {
+	r := require.New(t)
+	setupProfiles(t, testProfiles)
+
+	p, err := GetProfile("")
+	r.NoError(err)
+	r.Equal("staging", p.Name)
+
+	t.Setenv(ProfileEnvVar, "prod")
+	p, err = GetProfile("")
+	r.NoError(err)
+	r.Equal("prod", p.Name)
+
+	p, err = GetProfile("staging")
+	r.NoError(err)
+	r.Equal("https://staging.example.com", p.IssuerURL)
+
+	_, err = GetProfile("missing")
+	r.Error(err)
+}
+
+func TestSaveProfile(t *testing.T) {
+	r := require.New(t)
+	setupProfiles(t, "")
+
+	err := SaveProfile(Profile{Name: "dev", ClientID: "dev-client", IssuerURL: "https://dev.example.com"}, true)
+	r.NoError(err)
+
+	p, err := GetProfile("")
+	r.NoError(err)
+	r.Equal("dev", p.Name)
+	r.Equal("dev-client", p.ClientID)
+}
+
+func TestLogoutProfile(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+	setupProfiles(t, "")
+
+	idp := newFakeRevocationServer(t)
+	err := SaveProfile(Profile{Name: "prod", ClientID: "prod-client", IssuerURL: idp.URL}, false)
+	r.NoError(err)
+
+	s := storage.NewMemory(ctx, "prod-client", idp.URL)
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	err = LogoutProfile(ctx, "prod", WithStorage(storage.BackendMemory))
+	r.NoError(err)
+
+	got, err := s.Read(ctx)
+	r.NoError(err)
+	r.Nil(got)
+}
@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/cache"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+)
+
+// StatusReport describes the cached login for a client and issuer, and
+// where it is stored.
+type StatusReport struct {
+	ClientID  string `json:"client_id"`
+	IssuerURL string `json:"issuer_url"`
+
+	// LoggedIn is whether a token is cached, even if it has expired.
+	LoggedIn bool `json:"logged_in"`
+	// Valid is whether the cached access token can be used without a
+	// refresh.
+	Valid bool `json:"valid"`
+
+	Subject           string   `json:"subject,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	Name              string   `json:"name,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+
+	AccessTokenExpiry *time.Time `json:"access_token_expiry,omitempty"`
+	IDTokenExpiry     *time.Time `json:"id_token_expiry,omitempty"`
+	HasRefreshToken   bool       `json:"has_refresh_token"`
+	// RefreshTokenExpiry is only known when the IdP supports token
+	// introspection.
+	RefreshTokenExpiry *time.Time `json:"refresh_token_expiry,omitempty"`
+
+	StorageBackend string `json:"storage_backend"`
+	// CachePath is empty for backends not stored in a file.
+	CachePath string `json:"cache_path,omitempty"`
+	LockPath  string `json:"lock_path"`
+
+	// RootCache is set when a local cache dir is in use.
+	RootCache *RootCacheStatus `json:"root_cache,omitempty"`
+}
+
+// RootCacheStatus compares the root (e.g. NFS) cache with the node-local
+// cache in use.
+type RootCacheStatus struct {
+	Path               string     `json:"path,omitempty"`
+	LoggedIn           bool       `json:"logged_in"`
+	RefreshTokenExpiry *time.Time `json:"refresh_token_expiry,omitempty"`
+	// Diverged is whether the root cache holds a different token than
+	// the local cache, e.g. after a login on another host.
+	Diverged bool `json:"diverged"`
+}
+
+// Status reports the cached login for clientID and issuerURL without
+// refreshing it or contacting the IdP. It is not read-only: the storage
+// backend is opened and read as GetToken would, which may bootstrap the
+// local cache from the root cache, create the encryption key, or encrypt a
+// plaintext cache file.
+func Status(
+	ctx context.Context,
+	clientID string,
+	issuerURL string,
+	opts ...GetTokenOption,
+) (*StatusReport, error) {
+	var cfg getTokenConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	ctx, logger := logging.NewLogger(ctx)
+	logger.Debug("Status: started",
+		"client_id", clientID,
+		"issuer_url", issuerURL,
+	)
+
+	backendName := cfg.storageName
+	if backendName == "" {
+		name, err := storage.DetectBackend(ctx, cfg.fileOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("detecting storage backend: %w", err)
+		}
+		backendName = name
+	}
+
+	storageBackend, err := storage.Get(ctx, backendName, clientID, issuerURL, cfg.fileOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage backend: %w", err)
+	}
+
+	lockPath, err := lockFilePath(clientID, issuerURL, cfg.localCacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("getting lock file path: %w", err)
+	}
+
+	token, err := cache.NewCache(ctx, storageBackend, nil, nil).DecodeFromStorage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("decoding cached token: %w", err)
+	}
+
+	report := &StatusReport{
+		ClientID:       clientID,
+		IssuerURL:      issuerURL,
+		StorageBackend: backendName,
+		CachePath:      storagePath(storageBackend),
+		LockPath:       lockPath,
+	}
+	report.setToken(token)
+
+	if cfg.localCacheDir != "" {
+		rootStorage, err := storage.Get(ctx, backendName, clientID, issuerURL, cfg.rootFileOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("getting root storage backend: %w", err)
+		}
+		rootToken, err := cache.NewCache(ctx, rootStorage, nil, nil).DecodeFromStorage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("decoding root cached token: %w", err)
+		}
+		report.RootCache = &RootCacheStatus{
+			Path:               storagePath(rootStorage),
+			LoggedIn:           rootToken.AccessToken != "",
+			RefreshTokenExpiry: rootToken.RefreshTokenExpiry,
+			Diverged: rootToken.AccessToken != token.AccessToken ||
+				rootToken.RefreshToken != token.RefreshToken,
+		}
+	}
+
+	logger.Debug("Status: completed",
+		"logged_in", report.LoggedIn,
+		"valid", report.Valid,
+		"storage_backend", report.StorageBackend,
+	)
+	return report, nil
+}
+
+// setToken fills in the report from the cached token.
+func (r *StatusReport) setToken(token *client.Token) {
+	if token.AccessToken == "" {
+		return
+	}
+	r.LoggedIn = true
+	r.Valid = token.Valid()
+
+	r.Subject = token.Claims.Subject
+	r.Email = token.Claims.Email
+	r.Name = token.Claims.Name
+	r.PreferredUsername = token.Claims.PreferredUsername
+	r.Groups = token.Claims.Groups
+
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry
+		r.AccessTokenExpiry = &expiry
+	}
+	if expiry, ok := token.IDTokenExpiry(); ok {
+		r.IDTokenExpiry = &expiry
+	}
+	r.HasRefreshToken = token.RefreshToken != ""
+	r.RefreshTokenExpiry = token.RefreshTokenExpiry
+}
+
+// storagePath returns the file a storage backend keeps the token in, if
+// any.
+func storagePath(s storage.Storage) string {
+	if p, ok := s.(interface{ Path() string }); ok {
+		return p.Path()
+	}
+	return ""
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *StatusReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report for humans, e.g. for a whoami command.
+func (r *StatusReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+	now := time.Now()
+
+	if !r.LoggedIn {
+		fmt.Fprintf(&b, "Not logged in to %s\n", r.IssuerURL)
+	} else {
+		identity := r.Email
+		if identity == "" {
+			identity = r.PreferredUsername
+		}
+		if identity == "" {
+			identity = r.Subject
+		}
+		fmt.Fprintf(&b, "Logged in to %s as %s\n", r.IssuerURL, identity)
+	}
+
+	line := func(label, value string) {
+		fmt.Fprintf(&b, "  %-15s %s\n", label+":", value)
+	}
+	line("Client ID", r.ClientID)
+	if r.LoggedIn {
+		if r.Name != "" {
+			line("Name", r.Name)
+		}
+		line("Subject", r.Subject)
+		if len(r.Groups) > 0 {
+			line("Groups", strings.Join(r.Groups, ", "))
+		}
+		line("Access token", describeExpiry(r.AccessTokenExpiry, now))
+		line("ID token", describeExpiry(r.IDTokenExpiry, now))
+		switch {
+		case !r.HasRefreshToken:
+			line("Refresh token", "none")
+		case r.RefreshTokenExpiry == nil:
+			line("Refresh token", "present, expiry unknown")
+		default:
+			line("Refresh token", describeExpiry(r.RefreshTokenExpiry, now))
+		}
+	}
+
+	storageDesc := r.StorageBackend
+	if r.CachePath != "" {
+		storageDesc += " (" + r.CachePath + ")"
+	}
+	line("Storage", storageDesc)
+	line("Lock", r.LockPath)
+
+	if r.RootCache != nil {
+		state := "in sync"
+		switch {
+		case r.RootCache.Diverged && !r.RootCache.LoggedIn:
+			state = "diverged, root cache is empty"
+		case r.RootCache.Diverged:
+			state = "diverged, the root cache holds another token"
+		}
+		line("Root cache", fmt.Sprintf("%s (%s)", r.RootCache.Path, state))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// describeExpiry renders an expiry relative to now.
+func describeExpiry(expiry *time.Time, now time.Time) string {
+	if expiry == nil {
+		return "unknown expiry"
+	}
+	when := expiry.Local().Format(time.RFC3339)
+	d := expiry.Sub(now).Truncate(time.Second)
+	if d < 0 {
+		return fmt.Sprintf("expired %s ago (%s)", -d, when)
+	}
+	return fmt.Sprintf("expires in %s (%s)", d, when)
+}
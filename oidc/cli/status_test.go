@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestStatusNotLoggedIn(t *testing.T) {
+	r := require.New(t)
+	t.Setenv("HOME", t.TempDir())
+
+	report, err := Status(context.Background(), uuid.NewString(), "https://idp.example.com", WithStorage(storage.BackendMemory))
+	r.NoError(err)
+	r.False(report.LoggedIn)
+	r.Equal(storage.BackendMemory, report.StorageBackend)
+	r.Empty(report.CachePath)
+	r.Nil(report.RootCache)
+
+	out := &bytes.Buffer{}
+	r.NoError(report.WriteText(out))
+	r.Contains(out.String(), "Not logged in to https://idp.example.com")
+}
+
+func TestStatusWithLocalCache(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+	localDir := t.TempDir()
+	clientID := uuid.NewString()
+	issuerURL := "https://idp.example.com"
+	opts := []GetTokenOption{WithStorage(storage.BackendFile), WithLocalCacheDir(localDir)}
+
+	idTokenExpiry := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	refreshExpiry := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	local, err := storage.Get(ctx, storage.BackendFile, clientID, issuerURL, storage.WithLocalCacheDir(localDir))
+	r.NoError(err)
+	storeToken(t, local, &client.Token{
+		// the ID token's expiry is read from the token, not the claims
+		IDToken: testIDToken(idTokenExpiry),
+		Claims: client.Claims{
+			Subject: "user",
+			Email:   "user@example.com",
+			Groups:  []string{"admins"},
+		},
+		Token: &oauth2.Token{
+			AccessToken:  "local-access",
+			RefreshToken: "local-refresh",
+			Expiry:       time.Now().Add(time.Hour),
+		},
+		RefreshTokenExpiry: &refreshExpiry,
+	})
+	root, err := storage.Get(ctx, storage.BackendFile, clientID, issuerURL)
+	r.NoError(err)
+	storeToken(t, root, &client.Token{
+		Token: &oauth2.Token{
+			AccessToken:  "root-access",
+			RefreshToken: "root-refresh",
+			Expiry:       time.Now().Add(time.Hour),
+		},
+	})
+
+	report, err := Status(ctx, clientID, issuerURL, opts...)
+	r.NoError(err)
+	r.True(report.LoggedIn)
+	r.True(report.Valid)
+	r.Equal("user@example.com", report.Email)
+	r.Equal([]string{"admins"}, report.Groups)
+	r.True(idTokenExpiry.Equal(*report.IDTokenExpiry))
+	r.True(refreshExpiry.Equal(*report.RefreshTokenExpiry))
+	r.Equal(storage.BackendFile, report.StorageBackend)
+	r.Equal(localDir, filepath.Dir(report.CachePath))
+	r.Equal(localDir, filepath.Dir(report.LockPath))
+	r.NotNil(report.RootCache)
+	r.True(report.RootCache.Diverged)
+	r.NotEqual(report.CachePath, report.RootCache.Path)
+
+	out := &bytes.Buffer{}
+	r.NoError(report.WriteText(out))
+	r.Contains(out.String(), "Logged in to https://idp.example.com as user@example.com")
+	r.Contains(out.String(), "diverged")
+
+	out.Reset()
+	r.NoError(report.WriteJSON(out))
+	var decoded StatusReport
+	r.NoError(json.Unmarshal(out.Bytes(), &decoded))
+	r.Equal(report.CachePath, decoded.CachePath)
+	r.True(decoded.RootCache.Diverged)
+}
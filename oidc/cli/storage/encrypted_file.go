@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// encryptedPrefix marks a cache file as encrypted. Plaintext cache
+	// contents are gzip data and can never start with this prefix.
+	encryptedPrefix = "oidc-enc:v1:"
+	// keyFileName is the name of the default key file inside DefaultKeyDir.
+	keyFileName = "key"
+	// keyFileSize is the number of random bytes written to a new key file.
+	keyFileSize = 32
+	hkdfInfo    = "oidc-cli encrypted file storage v1"
+)
+
+// EncryptedFile is a File storage backend that encrypts values at rest
+// with XChaCha20-Poly1305. The key is derived from a local key file that
+// must only be readable by the current user. Existing plaintext cache
+// files are transparently re-written encrypted on first read.
+type EncryptedFile struct {
+	file *File
+	aead cipher.AEAD
+	// aad binds each ciphertext to its clientID and issuerURL so cache
+	// files cannot be swapped between clients.
+	aad []byte
+
+	// rootMu guards rootMigrated, set once a plaintext root (e.g. NFS)
+	// cache file has been re-written encrypted.
+	rootMu       sync.Mutex
+	rootMigrated bool
+
+	log *slog.Logger
+}
+
+// DefaultKeyDir returns the per-user directory the default key file is
+// kept in, under os.UserConfigDir (e.g. ~/.config/oidc-cli on Linux). It
+// is kept apart from DefaultStorageDir so that a shared cache dir never
+// holds the key next to the ciphertext.
+func DefaultKeyDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("getting user config directory: %w", err)
+	}
+	return filepath.Join(dir, "oidc-cli"), nil
+}
+
+// DefaultKeyFile returns the default location of the encryption key file.
+func DefaultKeyFile() (string, error) {
+	dir, err := DefaultKeyDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, keyFileName), nil
+}
+
+// NewEncryptedFile returns an encrypted file storage backend. If keyFile
+// is empty, DefaultKeyFile is used. The key file is created with 0600
+// permissions when it does not exist, and must not be in the cache dir.
+func NewEncryptedFile(
+	ctx context.Context,
+	dir string,
+	clientID string,
+	issuerURL string,
+	keyFile string,
+	opts ...FileOption,
+) (*EncryptedFile, error) {
+	if keyFile == "" {
+		k, err := DefaultKeyFile()
+		if err != nil {
+			return nil, fmt.Errorf("determining key file: %w", err)
+		}
+		keyFile = k
+	}
+
+	file, err := NewFile(ctx, dir, clientID, issuerURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDir := filepath.Clean(filepath.Dir(keyFile))
+	if keyDir == filepath.Clean(dir) || keyDir == filepath.Clean(file.dir) {
+		return nil, fmt.Errorf("key file %s must not be stored in the cache directory", keyFile)
+	}
+
+	secret, err := loadOrCreateKeyFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hkdf.Key(sha256.New, secret, nil, hkdfInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("deriving encryption key: %w", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	log := logging.FromContext(ctx)
+	log.Debug("EncryptedFile storage initialized",
+		"key_file", keyFile,
+		"cache_file", file.key,
+		"client_id", clientID,
+	)
+	return &EncryptedFile{
+		file: file,
+		aead: aead,
+		aad:  []byte(fmt.Sprintf("%s %s %s", storageVersion, clientID, issuerURL)),
+		log:  log,
+	}, nil
+}
+
+// loadOrCreateKeyFile reads the key file, generating it first if it does
+// not exist. Key files readable by group or others are rejected.
+func loadOrCreateKeyFile(path string) ([]byte, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("creating key dir: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		secret := make([]byte, keyFileSize)
+		_, err = rand.Read(secret)
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("generating key: %w", err)
+		}
+		_, err = f.Write(secret)
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("writing key file: %w", err)
+		}
+		err = f.Close()
+		if err != nil {
+			os.Remove(path)
+			return nil, fmt.Errorf("closing key file: %w", err)
+		}
+		return secret, nil
+	}
+	if !os.IsExist(err) {
+		return nil, fmt.Errorf("creating key file: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat key file: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("key file %s has permissions %s, expected 0600", path, info.Mode().Perm())
+	}
+
+	secret, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	if len(secret) < keyFileSize {
+		return nil, fmt.Errorf("key file %s is too short: got %d bytes, need at least %d", path, len(secret), keyFileSize)
+	}
+	return secret, nil
+}
+
+// Path returns the path of the cache file in use.
+func (e *EncryptedFile) Path() string {
+	return e.file.Path()
+}
+
+func (e *EncryptedFile) Read(ctx context.Context) (*string, error) {
+	contents, err := e.file.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if contents == nil {
+		return nil, nil
+	}
+
+	err = e.migrateRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(*contents, encryptedPrefix) {
+		e.log.Debug("EncryptedFile.Read: migrating plaintext cache file", "path", e.file.key)
+		err = e.Set(ctx, *contents)
+		if err != nil {
+			return nil, fmt.Errorf("migrating plaintext cache file: %w", err)
+		}
+		return contents, nil
+	}
+
+	plaintext, err := e.decrypt(strings.TrimPrefix(*contents, encryptedPrefix))
+	if err != nil {
+		// Most likely the key file was rotated; treat like a corrupt cache.
+		e.log.Warn("EncryptedFile.Read: failed to decrypt cache file, treating as cache miss",
+			"path", e.file.key,
+			"error", err,
+		)
+		return nil, nil
+	}
+
+	stringContents := string(plaintext)
+	return &stringContents, nil
+}
+
+// migrateRoot re-writes a plaintext root (e.g. NFS) cache file encrypted.
+// With a local cache dir, bootstrapping only copies the root file to local
+// disk, so the plaintext on the root would otherwise stay there. It runs
+// once per EncryptedFile.
+func (e *EncryptedFile) migrateRoot() error {
+	if e.file.rootKey == "" {
+		return nil
+	}
+
+	e.rootMu.Lock()
+	defer e.rootMu.Unlock()
+	if e.rootMigrated {
+		return nil
+	}
+
+	contents, err := os.ReadFile(e.file.rootKey)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading root cache file: %w", err)
+	}
+	if err == nil && !strings.HasPrefix(string(contents), encryptedPrefix) {
+		e.log.Debug("EncryptedFile.Read: migrating plaintext root cache file", "path", e.file.rootKey)
+		sealed, err := e.encrypt(string(contents))
+		if err != nil {
+			return fmt.Errorf("migrating plaintext root cache file: %w", err)
+		}
+		err = atomicFileWrite(filepath.Dir(e.file.rootKey), e.file.rootKey, []byte(sealed))
+		if err != nil {
+			return fmt.Errorf("migrating plaintext root cache file: %w", err)
+		}
+	}
+
+	e.rootMigrated = true
+	return nil
+}
+
+func (e *EncryptedFile) decrypt(encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("b64 decoding ciphertext: %w", err)
+	}
+	if len(data) < e.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := data[:e.aead.NonceSize()], data[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, ciphertext, e.aad)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting: %w", err)
+	}
+	return plaintext, nil
+}
+
+// encrypt returns value sealed and encoded with encryptedPrefix.
+func (e *EncryptedFile) encrypt(value string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize(), e.aead.NonceSize()+len(value)+e.aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+
+	sealed := e.aead.Seal(nonce, nonce, []byte(value), e.aad)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (e *EncryptedFile) Set(ctx context.Context, value string) error {
+	sealed, err := e.encrypt(value)
+	if err != nil {
+		return err
+	}
+	return e.file.Set(ctx, sealed)
+}
+
+func (e *EncryptedFile) Delete(ctx context.Context) error {
+	return e.file.Delete(ctx)
+}
+
+func (e *EncryptedFile) MarshalOpts() []client.MarshalOpts {
+	return e.file.MarshalOpts()
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedFileReadWrite(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "key")
+
+	e, err := NewEncryptedFile(ctx, dir, "client-id", "issuer-url", keyFile)
+	r.NoError(err)
+
+	got, err := e.Read(ctx)
+	r.NoError(err)
+	r.Nil(got)
+
+	err = e.Set(ctx, "hello")
+	r.NoError(err)
+
+	raw, err := os.ReadFile(e.file.key)
+	r.NoError(err)
+	r.True(strings.HasPrefix(string(raw), encryptedPrefix))
+	r.NotContains(string(raw), "hello")
+
+	got, err = e.Read(ctx)
+	r.NoError(err)
+	r.NotNil(got)
+	r.Equal("hello", *got)
+
+	err = e.Delete(ctx)
+	r.NoError(err)
+
+	got, err = e.Read(ctx)
+	r.NoError(err)
+	r.Nil(got)
+}
+
+func TestEncryptedFileKeyFilePermissions(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "nested", "key")
+
+	_, err := NewEncryptedFile(ctx, t.TempDir(), "client-id", "issuer-url", keyFile)
+	r.NoError(err)
+
+	info, err := os.Stat(keyFile)
+	r.NoError(err)
+	r.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	err = os.Chmod(keyFile, 0644)
+	r.NoError(err)
+
+	_, err = NewEncryptedFile(ctx, t.TempDir(), "client-id", "issuer-url", keyFile)
+	r.Error(err)
+	r.Contains(err.Error(), "permissions")
+}
+
+func TestEncryptedFileMigratesPlaintext(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "key")
+
+	plain, err := NewFile(ctx, dir, "client-id", "issuer-url")
+	r.NoError(err)
+	err = plain.Set(ctx, "legacy-data")
+	r.NoError(err)
+
+	e, err := NewEncryptedFile(ctx, dir, "client-id", "issuer-url", keyFile)
+	r.NoError(err)
+
+	got, err := e.Read(ctx)
+	r.NoError(err)
+	r.NotNil(got)
+	r.Equal("legacy-data", *got)
+
+	raw, err := plain.Read(ctx)
+	r.NoError(err)
+	r.NotNil(raw)
+	r.True(strings.HasPrefix(*raw, encryptedPrefix), "plaintext file should be rewritten encrypted")
+
+	got, err = e.Read(ctx)
+	r.NoError(err)
+	r.NotNil(got)
+	r.Equal("legacy-data", *got)
+}
+
+func TestEncryptedFileWrongKeyIsCacheMiss(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	e, err := NewEncryptedFile(ctx, dir, "client-id", "issuer-url", filepath.Join(t.TempDir(), "key"))
+	r.NoError(err)
+	err = e.Set(ctx, "secret")
+	r.NoError(err)
+
+	other, err := NewEncryptedFile(ctx, dir, "client-id", "issuer-url", filepath.Join(t.TempDir(), "key"))
+	r.NoError(err)
+
+	got, err := other.Read(ctx)
+	r.NoError(err)
+	r.Nil(got)
+}
+
+func TestEncryptedFileBootstrapFromRoot(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	nfsDir := t.TempDir()
+	localDir := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "key")
+
+	root, err := NewEncryptedFile(ctx, nfsDir, "client-id", "issuer-url", keyFile)
+	r.NoError(err)
+	err = root.Set(ctx, "root-data")
+	r.NoError(err)
+
+	local, err := NewEncryptedFile(ctx, nfsDir, "client-id", "issuer-url", keyFile, WithLocalCacheDir(localDir))
+	r.NoError(err)
+
+	got, err := local.Read(ctx)
+	r.NoError(err)
+	r.NotNil(got)
+	r.Equal("root-data", *got)
+}
+
+func TestEncryptedFileDefaultKeyFileOutsideCacheDir(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+
+	cacheDir, err := DefaultStorageDir()
+	r.NoError(err)
+	keyFile, err := DefaultKeyFile()
+	r.NoError(err)
+	r.NotEqual(cacheDir, filepath.Dir(keyFile))
+
+	_, err = NewEncryptedFile(ctx, cacheDir, "client-id", "issuer-url", "")
+	r.NoError(err)
+	r.FileExists(keyFile)
+	r.NoFileExists(filepath.Join(cacheDir, keyFileName))
+
+	_, err = NewEncryptedFile(ctx, cacheDir, "client-id", "issuer-url", filepath.Join(cacheDir, "key"))
+	r.ErrorContains(err, "must not be stored in the cache directory")
+}
+
+func TestEncryptedFileMigratesPlaintextRoot(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	nfsDir := t.TempDir()
+	localDir := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "key")
+
+	plainRoot, err := NewFile(ctx, nfsDir, "client-id", "issuer-url")
+	r.NoError(err)
+	err = plainRoot.Set(ctx, "legacy-data")
+	r.NoError(err)
+
+	local, err := NewEncryptedFile(ctx, nfsDir, "client-id", "issuer-url", keyFile, WithLocalCacheDir(localDir))
+	r.NoError(err)
+
+	got, err := local.Read(ctx)
+	r.NoError(err)
+	r.NotNil(got)
+	r.Equal("legacy-data", *got)
+
+	for _, path := range []string{local.file.key, local.file.rootKey} {
+		raw, err := os.ReadFile(path)
+		r.NoError(err)
+		r.True(strings.HasPrefix(string(raw), encryptedPrefix), "%s should be rewritten encrypted", path)
+	}
+
+	root, err := NewEncryptedFile(ctx, nfsDir, "client-id", "issuer-url", keyFile)
+	r.NoError(err)
+	got, err = root.Read(ctx)
+	r.NoError(err)
+	r.NotNil(got)
+	r.Equal("legacy-data", *got)
+}
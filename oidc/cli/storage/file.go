@@ -28,6 +28,9 @@ type File struct {
 
 type fileConfig struct {
 	localCacheDir string
+
+	encrypt bool
+	keyFile string
 }
 
 // FileOption configures the File storage backend.
@@ -41,6 +44,16 @@ func WithLocalCacheDir(dir string) FileOption {
 	}
 }
 
+// WithEncryption makes the "file" backend, whether selected by name or by
+// GetOIDC, an EncryptedFile deriving its key from keyFile. An empty keyFile
+// uses DefaultKeyFile. It has no effect on NewFile itself.
+func WithEncryption(keyFile string) FileOption {
+	return func(c *fileConfig) {
+		c.encrypt = true
+		c.keyFile = keyFile
+	}
+}
+
 func NewFile(ctx context.Context, dir string, clientID string, issuerURL string, opts ...FileOption) (*File, error) {
 	var cfg fileConfig
 	for _, o := range opts {
@@ -79,6 +92,12 @@ func NewFile(ctx context.Context, dir string, clientID string, issuerURL string,
 	}, nil
 }
 
+// Path returns the path of the cache file in use, on node-local disk
+// when a local cache dir is configured.
+func (f *File) Path() string {
+	return f.key
+}
+
 func GenerateKey(dir string, clientID string, issuerURL string) string {
 	k := fmt.Sprintf("%s %s %s", storageVersion, clientID, issuerURL)
 	h := sha256.Sum256([]byte(k))
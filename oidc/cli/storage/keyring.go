@@ -2,8 +2,13 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
@@ -13,6 +18,16 @@ import (
 
 const (
 	service = "aws-oidc"
+
+	// maxChunkSize is the largest value stored in a single keyring entry.
+	// macOS limits the whole add-generic-password command to 4096 bytes,
+	// which includes the service, the key name (the client ID and issuer
+	// URL, plus a chunk suffix) and the base64 encoded value. Windows
+	// limits a credential to 2560 bytes.
+	maxChunkSize = 1800
+	// chunkManifestPrefix marks an entry as a manifest for a value split
+	// across multiple entries. Its format is <prefix><count>:<sha256 hex>.
+	chunkManifestPrefix = "oidc-keyring-chunked:v1:"
 )
 
 // Keyring implements the storage interface for the cache
@@ -20,9 +35,14 @@ const (
 //
 //	at the cost of less flexibility.
 //	We can re-evaluate as needed and update this struct
+//
+// Values larger than maxChunkSize are transparently split across multiple
+// entries, with a manifest entry under key recording the chunk count and
+// a hash of the full value.
 type Keyring struct {
-	key string
-	log *slog.Logger
+	key       string
+	chunkSize int
+	log       *slog.Logger
 
 	mu sync.Mutex
 }
@@ -37,8 +57,9 @@ func NewKeyring(ctx context.Context, clientID string, issuerURL string) *Keyring
 		"client_id", clientID,
 	)
 	return &Keyring{
-		key: key,
-		log: log,
+		key:       key,
+		chunkSize: maxChunkSize,
+		log:       log,
 	}
 }
 
@@ -57,24 +78,98 @@ func (k *Keyring) Read(ctx context.Context) (*string, error) {
 		return nil, fmt.Errorf("reading from keyring: %w", err)
 	}
 
+	if strings.HasPrefix(val, chunkManifestPrefix) {
+		return k.readChunks(val)
+	}
+
 	k.log.Debug("Keyring.Read: loaded from keyring", "key", k.key, "size_bytes", len(val))
 	return &val, nil
 }
 
+// readChunks reassembles a chunked value from its manifest. Missing chunks
+// or a hash mismatch (e.g. a partially overwritten value) are treated as a
+// cache miss.
+func (k *Keyring) readChunks(manifest string) (*string, error) {
+	count, sum, err := parseChunkManifest(manifest)
+	if err != nil {
+		k.log.Warn("Keyring.Read: invalid chunk manifest, treating as cache miss", "key", k.key, "error", err)
+		return nil, nil
+	}
+
+	var sb strings.Builder
+	for i := range count {
+		chunk, err := keyring.Get(service, k.chunkKey(i))
+		if err == keyring.ErrNotFound {
+			k.log.Warn("Keyring.Read: missing chunk, treating as cache miss", "key", k.key, "chunk", i)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading chunk %d from keyring: %w", i, err)
+		}
+		sb.WriteString(chunk)
+	}
+
+	val := sb.String()
+	got := sha256.Sum256([]byte(val))
+	if subtle.ConstantTimeCompare(got[:], sum) != 1 {
+		k.log.Warn("Keyring.Read: chunk hash mismatch, treating as cache miss", "key", k.key)
+		return nil, nil
+	}
+
+	k.log.Debug("Keyring.Read: loaded chunked value from keyring",
+		"key", k.key,
+		"chunks", count,
+		"size_bytes", len(val),
+	)
+	return &val, nil
+}
+
 // Set sets a value to the keyring
 func (k *Keyring) Set(ctx context.Context, value string) error {
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
-	err := keyring.Set(service, k.key, value)
-	if err == keyring.ErrNotFound {
+	oldChunks := k.existingChunkCount()
+
+	if len(value) <= k.chunkSize {
+		err := keyring.Set(service, k.key, value)
+		if err == keyring.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("setting value to keyring: %w", err)
+		}
+		k.deleteChunks(0, oldChunks)
+
+		k.log.Debug("Keyring.Set: saved to keyring", "key", k.key, "size_bytes", len(value))
 		return nil
 	}
+
+	count := 0
+	for start := 0; start < len(value); start += k.chunkSize {
+		end := min(start+k.chunkSize, len(value))
+		err := keyring.Set(service, k.chunkKey(count), value[start:end])
+		if err != nil {
+			return fmt.Errorf("setting chunk %d to keyring: %w", count, err)
+		}
+		count++
+	}
+
+	// The manifest is written last so readers never see a manifest
+	// pointing at chunks that have not been written yet.
+	sum := sha256.Sum256([]byte(value))
+	manifest := fmt.Sprintf("%s%d:%s", chunkManifestPrefix, count, hex.EncodeToString(sum[:]))
+	err := keyring.Set(service, k.key, manifest)
 	if err != nil {
-		return fmt.Errorf("setting value to keyring: %w", err)
+		return fmt.Errorf("setting chunk manifest to keyring: %w", err)
 	}
+	k.deleteChunks(count, oldChunks)
 
-	k.log.Debug("Keyring.Set: saved to keyring", "key", k.key, "size_bytes", len(value))
+	k.log.Debug("Keyring.Set: saved chunked value to keyring",
+		"key", k.key,
+		"chunks", count,
+		"size_bytes", len(value),
+	)
 	return nil
 }
 
@@ -83,6 +178,8 @@ func (k *Keyring) Delete(ctx context.Context) error {
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
+	k.deleteChunks(0, k.existingChunkCount())
+
 	err := keyring.Delete(service, k.key)
 	if err == keyring.ErrNotFound {
 		return nil
@@ -96,6 +193,51 @@ func (k *Keyring) Delete(ctx context.Context) error {
 	return nil
 }
 
+func (k *Keyring) chunkKey(i int) string {
+	return fmt.Sprintf("%s chunk-%d", k.key, i)
+}
+
+// existingChunkCount returns the number of chunks referenced by the
+// current manifest, or 0 if the stored value is not chunked.
+func (k *Keyring) existingChunkCount() int {
+	val, err := keyring.Get(service, k.key)
+	if err != nil || !strings.HasPrefix(val, chunkManifestPrefix) {
+		return 0
+	}
+	count, _, err := parseChunkManifest(val)
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// deleteChunks removes chunk entries in [from, to). Failures are logged
+// but not propagated since stale chunks are never read without a manifest.
+func (k *Keyring) deleteChunks(from, to int) {
+	for i := from; i < to; i++ {
+		err := keyring.Delete(service, k.chunkKey(i))
+		if err != nil && err != keyring.ErrNotFound {
+			k.log.Warn("Keyring: failed to delete stale chunk", "key", k.key, "chunk", i, "error", err)
+		}
+	}
+}
+
+func parseChunkManifest(manifest string) (int, []byte, error) {
+	countStr, sumStr, ok := strings.Cut(strings.TrimPrefix(manifest, chunkManifestPrefix), ":")
+	if !ok {
+		return 0, nil, fmt.Errorf("malformed chunk manifest")
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return 0, nil, fmt.Errorf("invalid chunk count %q", countStr)
+	}
+	sum, err := hex.DecodeString(sumStr)
+	if err != nil || len(sum) != sha256.Size {
+		return 0, nil, fmt.Errorf("invalid chunk hash %q", sumStr)
+	}
+	return count, sum, nil
+}
+
 func (k *Keyring) MarshalOpts() []client.MarshalOpts {
 	return []client.MarshalOpts{}
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	guuid "github.com/google/uuid"
@@ -48,3 +49,76 @@ func TestKeyringSetReadDelete(t *testing.T) {
 	err = k.Delete(ctx)
 	r.Nil(err)
 }
+
+func TestKeyringChunkedSetReadDelete(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	val := strings.Repeat("0123456789", 3*maxChunkSize/10+7)
+
+	id := guuid.New()
+	k := NewKeyring(ctx, id.String(), "testo")
+
+	err := k.Set(ctx, val)
+	r.Nil(err)
+
+	manifest, err := keyring.Get(service, k.key)
+	r.Nil(err)
+	r.True(strings.HasPrefix(manifest, chunkManifestPrefix))
+	r.Equal(4, k.existingChunkCount())
+
+	got, err := k.Read(ctx)
+	r.Nil(err)
+	r.NotNil(got)
+	r.Equal(val, *got)
+
+	err = k.Delete(ctx)
+	r.Nil(err)
+
+	_, err = keyring.Get(service, k.chunkKey(0))
+	r.Equal(keyring.ErrNotFound, err)
+
+	got, err = k.Read(ctx)
+	r.Nil(err)
+	r.Nil(got)
+}
+
+func TestKeyringChunkedOverwriteRemovesStaleChunks(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	id := guuid.New()
+	k := NewKeyring(ctx, id.String(), "testo")
+
+	err := k.Set(ctx, strings.Repeat("a", 3*maxChunkSize))
+	r.Nil(err)
+
+	err = k.Set(ctx, "small")
+	r.Nil(err)
+
+	_, err = keyring.Get(service, k.chunkKey(0))
+	r.Equal(keyring.ErrNotFound, err)
+
+	got, err := k.Read(ctx)
+	r.Nil(err)
+	r.NotNil(got)
+	r.Equal("small", *got)
+}
+
+func TestKeyringChunkedHashMismatch(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	id := guuid.New()
+	k := NewKeyring(ctx, id.String(), "testo")
+
+	err := k.Set(ctx, strings.Repeat("a", 2*maxChunkSize))
+	r.Nil(err)
+
+	err = keyring.Set(service, k.chunkKey(1), "tampered")
+	r.Nil(err)
+
+	got, err := k.Read(ctx)
+	r.Nil(err)
+	r.Nil(got)
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+)
+
+var (
+	memoryMu    sync.Mutex
+	memoryStore = map[string]string{}
+)
+
+// Memory implements the storage interface in process memory.
+// Values are shared by every Memory with the same clientID and issuerURL
+// for the lifetime of the process, and are never persisted.
+type Memory struct {
+	key string
+	log *slog.Logger
+}
+
+// NewMemory returns a new in-memory storage
+func NewMemory(ctx context.Context, clientID string, issuerURL string) *Memory {
+	key := fmt.Sprintf("%s %s %s", storageVersion, issuerURL, clientID)
+	log := logging.FromContext(ctx)
+	log.Debug("Memory storage initialized",
+		"key", key,
+		"client_id", clientID,
+	)
+	return &Memory{
+		key: key,
+		log: log,
+	}
+}
+
+func (m *Memory) Read(_ context.Context) (*string, error) {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	val, ok := memoryStore[m.key]
+	if !ok {
+		m.log.Debug("Memory.Read: key not found", "key", m.key)
+		return nil, nil
+	}
+	return &val, nil
+}
+
+func (m *Memory) Set(_ context.Context, value string) error {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	memoryStore[m.key] = value
+	m.log.Debug("Memory.Set: saved to memory", "key", m.key, "size_bytes", len(value))
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context) error {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	delete(memoryStore, m.key)
+	return nil
+}
+
+func (m *Memory) MarshalOpts() []client.MarshalOpts {
+	return []client.MarshalOpts{}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	// StorageEnvVar selects a storage backend by name, overriding
+	// environment detection in GetOIDC.
+	StorageEnvVar = "OIDC_CLI_STORAGE"
+
+	BackendFile          = "file"
+	BackendEncryptedFile = "encrypted-file"
+	BackendKeyring       = "keyring"
+	BackendMemory        = "memory"
+)
+
+// ErrUnknownBackend is returned by Get for a name no backend was
+// registered under.
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Factory creates a Storage for the given clientID and issuerURL.
+// FileOptions are passed through so file-based backends can honor them;
+// other backends are free to ignore them.
+type Factory func(ctx context.Context, clientID string, issuerURL string, fileOpts ...FileOption) (Storage, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+func init() {
+	Register(BackendFile, newDefaultFile)
+	Register(BackendEncryptedFile, newDefaultEncryptedFile)
+	Register(BackendKeyring, func(ctx context.Context, clientID string, issuerURL string, _ ...FileOption) (Storage, error) {
+		return NewKeyring(ctx, clientID, issuerURL), nil
+	})
+	Register(BackendMemory, func(ctx context.Context, clientID string, issuerURL string, _ ...FileOption) (Storage, error) {
+		return NewMemory(ctx, clientID, issuerURL), nil
+	})
+}
+
+// Register makes a storage backend available by name to Get, GetOIDC
+// (via OIDC_CLI_STORAGE) and cli.WithStorage. It panics if factory is
+// nil or name is already registered.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("storage: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("storage: Register called twice for backend %q", name))
+	}
+	registry[name] = factory
+}
+
+// Backends returns the sorted names of all registered storage backends.
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the storage backend registered under name.
+func Get(ctx context.Context, name string, clientID string, issuerURL string, fileOpts ...FileOption) (Storage, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, must be one of %v", ErrUnknownBackend, name, Backends())
+	}
+	return factory(ctx, clientID, issuerURL, fileOpts...)
+}
+
+// newDefaultFile returns the file backend, encrypted when WithEncryption is
+// set so that selecting "file" by name never drops encryption.
+func newDefaultFile(ctx context.Context, clientID string, issuerURL string, fileOpts ...FileOption) (Storage, error) {
+	var cfg fileConfig
+	for _, o := range fileOpts {
+		o(&cfg)
+	}
+	if cfg.encrypt {
+		return newDefaultEncryptedFile(ctx, clientID, issuerURL, fileOpts...)
+	}
+
+	dir, err := DefaultStorageDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewFile(ctx, dir, clientID, issuerURL, fileOpts...)
+}
+
+func newDefaultEncryptedFile(ctx context.Context, clientID string, issuerURL string, fileOpts ...FileOption) (Storage, error) {
+	dir, err := DefaultStorageDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg fileConfig
+	for _, o := range fileOpts {
+		o(&cfg)
+	}
+	return NewEncryptedFile(ctx, dir, clientID, issuerURL, cfg.keyFile, fileOpts...)
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	guuid "github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryBuiltins(t *testing.T) {
+	r := require.New(t)
+
+	backends := Backends()
+	r.Contains(backends, BackendFile)
+	r.Contains(backends, BackendEncryptedFile)
+	r.Contains(backends, BackendKeyring)
+	r.Contains(backends, BackendMemory)
+}
+
+func TestRegistryUnknownBackend(t *testing.T) {
+	r := require.New(t)
+
+	_, err := Get(context.Background(), "does-not-exist", "client-id", "issuer-url")
+	r.ErrorIs(err, ErrUnknownBackend)
+	r.Contains(err.Error(), "unknown storage backend")
+}
+
+func TestRegistryCustomBackend(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	name := guuid.New().String()
+
+	var gotClientID string
+	Register(name, func(ctx context.Context, clientID string, issuerURL string, _ ...FileOption) (Storage, error) {
+		gotClientID = clientID
+		return NewMemory(ctx, clientID, issuerURL), nil
+	})
+
+	s, err := Get(ctx, name, "client-id", "issuer-url")
+	r.NoError(err)
+	r.IsType(&Memory{}, s)
+	r.Equal("client-id", gotClientID)
+
+	r.Panics(func() {
+		Register(name, func(context.Context, string, string, ...FileOption) (Storage, error) {
+			return nil, nil
+		})
+	})
+}
+
+func TestRegistryFileHonorsEncryption(t *testing.T) {
+	r := require.New(t)
+	t.Setenv("HOME", t.TempDir())
+	keyFile := filepath.Join(t.TempDir(), "key")
+
+	s, err := Get(context.Background(), BackendFile, "client-id", "issuer-url", WithEncryption(keyFile))
+	r.NoError(err)
+	r.IsType(&EncryptedFile{}, s)
+
+	s, err = Get(context.Background(), BackendFile, "client-id", "issuer-url")
+	r.NoError(err)
+	r.IsType(&File{}, s)
+}
+
+func TestGetOIDCFromEnv(t *testing.T) {
+	r := require.New(t)
+	t.Setenv(StorageEnvVar, BackendMemory)
+
+	s, err := GetOIDC(context.Background(), "client-id", "issuer-url")
+	r.NoError(err)
+	r.IsType(&Memory{}, s)
+}
+
+func TestMemorySetReadDelete(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	id := guuid.New().String()
+
+	m := NewMemory(ctx, id, "issuer-url")
+	got, err := m.Read(ctx)
+	r.NoError(err)
+	r.Nil(got)
+
+	err = m.Set(ctx, "value")
+	r.NoError(err)
+
+	// a second instance for the same client shares the value
+	got, err = NewMemory(ctx, id, "issuer-url").Read(ctx)
+	r.NoError(err)
+	r.NotNil(got)
+	r.Equal("value", *got)
+
+	err = m.Delete(ctx)
+	r.NoError(err)
+
+	got, err = m.Read(ctx)
+	r.NoError(err)
+	r.Nil(got)
+}
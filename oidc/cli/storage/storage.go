@@ -32,19 +32,39 @@ type Storage interface {
 	MarshalOpts() []client.MarshalOpts
 }
 
+// GetOIDC returns the storage backend for the given clientID and issuerURL,
+// registered under the name returned by DetectBackend.
 func GetOIDC(ctx context.Context, clientID string, issuerURL string, fileOpts ...FileOption) (Storage, error) {
+	name, err := DetectBackend(ctx, fileOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return Get(ctx, name, clientID, issuerURL, fileOpts...)
+}
+
+// DetectBackend returns the name of the storage backend GetOIDC uses. If
+// OIDC_CLI_STORAGE is set, it is returned. Otherwise the backend is chosen
+// based on the environment.
+func DetectBackend(ctx context.Context, fileOpts ...FileOption) (string, error) {
 	log := logging.FromContext(ctx)
 
+	if name := os.Getenv(StorageEnvVar); name != "" {
+		log.Debug("DetectBackend: using storage backend from environment",
+			"env_var", StorageEnvVar,
+			"backend", name,
+		)
+		return name, nil
+	}
+
 	isWSL, err := osutil.IsWSL()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	isDesktop := osutil.IsDesktopEnvironment()
 
-	log.Debug("GetOIDC: detected environment",
+	log.Debug("DetectBackend: detected environment",
 		"is_wsl", isWSL,
 		"is_desktop", isDesktop,
-		"client_id", clientID,
 	)
 
 	// If WSL we use a file storage which does not cache refreshTokens
@@ -54,14 +74,19 @@ func GetOIDC(ctx context.Context, clientID string, issuerURL string, fileOpts ..
 	//    we disable this part of the flow for WSL. This could change in the future
 	//    when we find a better way to work with a WSL secure storage.
 	if isWSL || !isDesktop {
-		dir, err := DefaultStorageDir()
-		if err != nil {
-			return nil, err
+		var cfg fileConfig
+		for _, o := range fileOpts {
+			o(&cfg)
 		}
-		log.Debug("GetOIDC: using file storage backend", "dir", dir)
-		return NewFile(ctx, dir, clientID, issuerURL, fileOpts...)
+		if cfg.encrypt {
+			log.Debug("DetectBackend: using encrypted file storage backend")
+			return BackendEncryptedFile, nil
+		}
+
+		log.Debug("DetectBackend: using file storage backend")
+		return BackendFile, nil
 	}
 
-	log.Debug("GetOIDC: using keyring storage backend")
-	return NewKeyring(ctx, clientID, issuerURL), nil
+	log.Debug("DetectBackend: using keyring storage backend")
+	return BackendKeyring, nil
 }
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/cache"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+	"github.com/chanzuckerberg/go-misc/pidlock"
+)
+
+// GetExchangedToken returns a token for audience obtained by exchanging the
+// user's OIDC token (RFC 8693). The exchanged token is cached separately per
+// audience in the same storage backend, and re-exchanged from the (cached or
+// refreshed) OIDC token once it expires.
+func GetExchangedToken(
+	ctx context.Context,
+	clientID string,
+	issuerURL string,
+	audience string,
+	opts ...GetTokenOption,
+) (*client.Token, error) {
+	var cfg getTokenConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	ctx, logger := logging.NewLogger(ctx)
+	startTime := time.Now()
+
+	logger.Debug("GetExchangedToken: started",
+		"client_id", clientID,
+		"issuer_url", issuerURL,
+		"audience", audience,
+	)
+
+	err := recordExchangeAudience(ctx, &cfg, clientID, issuerURL, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	exchangeCache, err := newExchangeCache(ctx, clientID, issuerURL, audience, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := exchangeCache.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting exchanged token: %w", err)
+	}
+
+	logger.Debug("GetExchangedToken: completed",
+		"elapsed_ms", time.Since(startTime).Milliseconds(),
+		"token_expiry", token.Token.Expiry,
+	)
+	return token, nil
+}
+
+// exchangeCacheID is the identity exchanged tokens for audience are cached
+// under, keeping them apart from the OIDC token and other audiences.
+func exchangeCacheID(clientID, audience string) string {
+	return fmt.Sprintf("%s token-exchange %s", clientID, audience)
+}
+
+// exchangeAudiencesID is the identity the audiences of cached exchanged
+// tokens are recorded under, so Logout can find them: backends such as the
+// keyring can't list their entries.
+func exchangeAudiencesID(clientID string) string {
+	return fmt.Sprintf("%s token-exchange audiences", clientID)
+}
+
+// exchangeAudiences returns the storage the audiences of exchanged tokens
+// are recorded in, and the recorded audiences.
+func exchangeAudiences(ctx context.Context, cfg *getTokenConfig, clientID, issuerURL string) (storage.Storage, []string, error) {
+	s, err := cfg.getStorage(ctx, exchangeAudiencesID(clientID), issuerURL, cfg.fileOptions...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting storage backend: %w", err)
+	}
+	value, err := s.Read(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading exchanged token audiences: %w", err)
+	}
+	if value == nil {
+		return s, nil, nil
+	}
+
+	var audiences []string
+	err = json.Unmarshal([]byte(*value), &audiences)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding exchanged token audiences: %w", err)
+	}
+	return s, audiences, nil
+}
+
+// recordExchangeAudience records audience before its exchanged token is
+// cached, unless it already is.
+func recordExchangeAudience(ctx context.Context, cfg *getTokenConfig, clientID, issuerURL, audience string) error {
+	_, audiences, err := exchangeAudiences(ctx, cfg, clientID, issuerURL)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(audiences, audience) {
+		return nil
+	}
+
+	lockPath, err := lockFilePath(exchangeAudiencesID(clientID), issuerURL, cfg.localCacheDir)
+	if err != nil {
+		return fmt.Errorf("getting lock file path: %w", err)
+	}
+	fileLock, err := pidlock.NewLock(lockPath)
+	if err != nil {
+		return fmt.Errorf("creating lock: %w", err)
+	}
+	err = cache.AcquireLock(fileLock)
+	if err != nil {
+		return err
+	}
+	defer fileLock.Unlock() //nolint:errcheck
+
+	// re-read inside the lock in case another process added one
+	s, audiences, err := exchangeAudiences(ctx, cfg, clientID, issuerURL)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(audiences, audience) {
+		return nil
+	}
+	value, err := json.Marshal(append(audiences, audience))
+	if err != nil {
+		return fmt.Errorf("encoding exchanged token audiences: %w", err)
+	}
+	err = s.Set(ctx, string(value))
+	if err != nil {
+		return fmt.Errorf("recording exchanged token audience: %w", err)
+	}
+	return nil
+}
+
+// newExchangeCache returns a cache of exchanged tokens for audience whose
+// refresh function exchanges the OIDC token from the regular token cache.
+func newExchangeCache(ctx context.Context, clientID, issuerURL, audience string, cfg *getTokenConfig) (*cache.Cache, error) {
+	subjectCache, err := newTokenCache(ctx, clientID, issuerURL, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	clientOptions, err := cfg.oidcClientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	cacheID := exchangeCacheID(clientID, audience)
+	storageBackend, err := cfg.getStorage(ctx, cacheID, issuerURL, cfg.fileOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage backend: %w", err)
+	}
+
+	lockPath, err := lockFilePath(cacheID, issuerURL, cfg.localCacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("getting lock file path: %w", err)
+	}
+	fileLock, err := pidlock.NewLock(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("creating lock: %w", err)
+	}
+
+	oidcClient := lazyOIDCClient(clientID, issuerURL, clientOptions)
+	exchange := func(ctx context.Context, _ *client.Token) (*client.Token, error) {
+		subject, err := subjectCache.Read(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting token to exchange: %w", err)
+		}
+
+		req, err := client.NewTokenExchangeRequest(subject, audience)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := oidcClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.ExchangeToken(ctx, req)
+	}
+
+	// cfg.tokenChecks (e.g. a step-up requirement) only apply to the
+	// subject token, already enforced by subjectCache
+	return cache.NewCache(ctx, storageBackend, exchange, fileLock, cfg.cacheOptions...), nil
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// newFakeTokenExchangeServer serves a discovery document and a token
+// endpoint issuing "<audience>:<subject_token>" for token exchanges.
+func newFakeTokenExchangeServer(t *testing.T, exchanges *atomic.Int32) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+				"issuer":         srv.URL,
+				"token_endpoint": srv.URL + "/token",
+				"jwks_uri":       srv.URL + "/keys",
+			})
+		case "/token":
+			exchanges.Add(1)
+			json.NewEncoder(w).Encode(map[string]interface{}{ //nolint:errcheck
+				"access_token": req.FormValue("audience") + ":" + req.FormValue("subject_token"),
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetExchangedTokenCachesPerAudience(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	var exchanges atomic.Int32
+	idp := newFakeTokenExchangeServer(t, &exchanges)
+	clientID := uuid.NewString()
+
+	storeToken(t, storage.NewMemory(ctx, clientID, idp.URL), &client.Token{
+		IDToken: "user-id-token",
+		Token:   &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	opts := []GetTokenOption{WithStorage(storage.BackendMemory)}
+	token, err := GetExchangedToken(ctx, clientID, idp.URL, "api-a", opts...)
+	r.NoError(err)
+	r.Equal("api-a:user-id-token", token.AccessToken)
+	r.Equal(int32(1), exchanges.Load())
+
+	token, err = GetExchangedToken(ctx, clientID, idp.URL, "api-a", opts...)
+	r.NoError(err)
+	r.Equal("api-a:user-id-token", token.AccessToken)
+	r.Equal(int32(1), exchanges.Load(), "second call should be served from the cache")
+
+	token, err = GetExchangedToken(ctx, clientID, idp.URL, "api-b", opts...)
+	r.NoError(err)
+	r.Equal("api-b:user-id-token", token.AccessToken)
+	r.Equal(int32(2), exchanges.Load())
+
+	// the user's own token is untouched
+	subject, err := GetToken(ctx, clientID, idp.URL, opts...)
+	r.NoError(err)
+	r.Equal("access", subject.AccessToken)
+}
+
+func TestGetExchangedTokenStepUpChecksSubjectOnly(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	var exchanges atomic.Int32
+	idp := newFakeTokenExchangeServer(t, &exchanges)
+	clientID := uuid.NewString()
+
+	storeToken(t, storage.NewMemory(ctx, clientID, idp.URL), &client.Token{
+		IDToken: "user-id-token",
+		Claims:  client.Claims{ACR: "phr"},
+		Token:   &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	opts := []GetTokenOption{
+		WithStorage(storage.BackendMemory),
+		WithAuthenticationRequirement(client.AuthenticationRequirement{ACRValues: []string{"phr"}}),
+	}
+	for range 2 {
+		token, err := GetExchangedToken(ctx, clientID, idp.URL, "api", opts...)
+		r.NoError(err)
+		r.Equal("api:user-id-token", token.AccessToken)
+	}
+	// the exchanged token has no acr, but is still served from the cache
+	r.Equal(int32(1), exchanges.Load())
+}
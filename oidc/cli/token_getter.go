@@ -2,7 +2,9 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/cache"
@@ -14,8 +16,18 @@ import (
 
 type getTokenConfig struct {
 	localCacheDir string
+	storageName   string
 	fileOptions   []storage.FileOption
-	clientOptions []client.OIDCClientOption
+	// rootFileOptions are applied to the root (default/NFS) storage
+	// when a local cache dir is in use.
+	rootFileOptions []storage.FileOption
+	clientOptions   []client.OIDCClientOption
+	cacheOptions    []cache.CacheOption
+	// tokenChecks apply to the user's OIDC token only, not to exchanged
+	// tokens, which carry none of its claims.
+	tokenChecks []func(*client.Token) error
+	// refreshChecks reject a refreshed token before it is cached.
+	refreshChecks []func(*client.Token) error
 }
 
 // GetTokenOption configures GetToken behavior.
@@ -31,6 +43,36 @@ func WithLocalCacheDir(dir string) GetTokenOption {
 	}
 }
 
+// WithEncryptedFileStorage encrypts the file cache at rest when the file
+// storage backend is in use, whether detected (WSL / headless hosts) or
+// selected with WithStorage or OIDC_CLI_STORAGE. The key is derived from
+// keyFile, or storage.DefaultKeyFile when empty. Existing plaintext cache
+// files are migrated on first read.
+func WithEncryptedFileStorage(keyFile string) GetTokenOption {
+	return func(c *getTokenConfig) {
+		c.fileOptions = append(c.fileOptions, storage.WithEncryption(keyFile))
+		c.rootFileOptions = append(c.rootFileOptions, storage.WithEncryption(keyFile))
+	}
+}
+
+// WithStorage selects a storage backend registered with storage.Register
+// (e.g. "file", "keyring", "memory"), taking precedence over the
+// OIDC_CLI_STORAGE environment variable and environment detection.
+func WithStorage(name string) GetTokenOption {
+	return func(c *getTokenConfig) {
+		c.storageName = name
+	}
+}
+
+// WithRefreshAhead refreshes the cached token once it expires within d,
+// rather than waiting for it to expire, so callers do not pay for the
+// refresh round-trip on the first call after expiry.
+func WithRefreshAhead(d time.Duration) GetTokenOption {
+	return func(c *getTokenConfig) {
+		c.cacheOptions = append(c.cacheOptions, cache.WithRefreshAhead(d))
+	}
+}
+
 // WithClientOptions appends OIDCClientOptions to the underlying OIDC client.
 func WithClientOptions(opts ...client.OIDCClientOption) GetTokenOption {
 	return func(c *getTokenConfig) {
@@ -38,6 +80,50 @@ func WithClientOptions(opts ...client.OIDCClientOption) GetTokenOption {
 	}
 }
 
+// WithNonInteractive returns client.ErrInteractiveRequired instead of
+// opening a browser or prompting when the cached token can't be refreshed,
+// for cron jobs and editor integrations. Setting OIDC_CLI_NON_INTERACTIVE
+// has the same effect.
+func WithNonInteractive() GetTokenOption {
+	return func(c *getTokenConfig) {
+		c.clientOptions = append(c.clientOptions, client.WithNonInteractive())
+	}
+}
+
+// WithAuthenticationRequirement demands a step-up login, e.g. with
+// hardware MFA or within the last few minutes, for sensitive commands. A
+// cached token whose ID token claims don't satisfy req is not used; the
+// user authenticates again with acr_values and max_age requested.
+func WithAuthenticationRequirement(req client.AuthenticationRequirement) GetTokenOption {
+	return func(c *getTokenConfig) {
+		c.clientOptions = append(c.clientOptions, client.WithAuthenticationRequirement(req))
+		c.tokenChecks = append(c.tokenChecks, req.Check)
+	}
+}
+
+// oidcClientOptions returns the caller's OIDCClientOptions, preceded by one
+// persisting the discovery document next to the token cache so a warm
+// GetToken makes no network requests. Caller options may override it.
+func (c *getTokenConfig) oidcClientOptions() ([]client.OIDCClientOption, error) {
+	discoveryDir, err := cacheDir(c.localCacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("determining discovery cache dir: %w", err)
+	}
+	return append(
+		[]client.OIDCClientOption{client.WithDiscoveryCache(client.NewDiscoveryCache(discoveryDir, 0))},
+		c.clientOptions...,
+	), nil
+}
+
+// getStorage returns the explicitly selected storage backend, or defers to
+// storage.GetOIDC when none was selected.
+func (c *getTokenConfig) getStorage(ctx context.Context, clientID, issuerURL string, fileOpts ...storage.FileOption) (storage.Storage, error) {
+	if c.storageName != "" {
+		return storage.Get(ctx, c.storageName, clientID, issuerURL, fileOpts...)
+	}
+	return storage.GetOIDC(ctx, clientID, issuerURL, fileOpts...)
+}
+
 // GetToken gets an oidc token.
 // It handles caching with a default cache and keyring storage.
 func GetToken(
@@ -59,12 +145,71 @@ func GetToken(
 		"issuer_url", issuerURL,
 	)
 
-	oidcClient, err := client.NewOIDCClient(ctx, clientID, issuerURL, cfg.clientOptions...)
+	tokenCache, err := newTokenCache(ctx, clientID, issuerURL, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := tokenCache.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("extracting token from client: %w", err)
+	}
+	if token == nil {
+		return nil, fmt.Errorf("nil token from OIDC-IDP")
+	}
+
+	logger.Debug("GetToken: completed",
+		"elapsed_ms", time.Since(startTime).Milliseconds(),
+		"token_expiry", token.Token.Expiry,
+	)
+	return token, nil
+}
+
+// NewTokenSource returns a long-running token source that serves the
+// current token from memory and refreshes it in a background goroutine
+// ahead of expiry (cache.DefaultRefreshAhead unless WithRefreshAhead is set).
+// Call Close on the returned TokenSource, or cancel ctx, to stop refreshing.
+func NewTokenSource(
+	ctx context.Context,
+	clientID string,
+	issuerURL string,
+	opts ...GetTokenOption,
+) (*cache.TokenSource, error) {
+	var cfg getTokenConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	ctx, logger := logging.NewLogger(ctx)
+	logger.Debug("NewTokenSource: started",
+		"client_id", clientID,
+		"issuer_url", issuerURL,
+	)
+
+	tokenCache, err := newTokenCache(ctx, clientID, issuerURL, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err := cache.NewTokenSource(ctx, tokenCache)
+	if err != nil {
+		return nil, fmt.Errorf("extracting token from client: %w", err)
+	}
+	return ts, nil
+}
+
+// newTokenCache wires up the storage backend, refresh lock and a lazily
+// created OIDC client into a cache.Cache, syncing from the root cache first
+// when a local cache dir is configured.
+func newTokenCache(ctx context.Context, clientID, issuerURL string, cfg *getTokenConfig) (*cache.Cache, error) {
+	logger := logging.FromContext(ctx)
+
+	clientOptions, err := cfg.oidcClientOptions()
 	if err != nil {
-		return nil, fmt.Errorf("creating oidc client: %w", err)
+		return nil, err
 	}
 
-	storageBackend, err := storage.GetOIDC(ctx, clientID, issuerURL, cfg.fileOptions...)
+	storageBackend, err := cfg.getStorage(ctx, clientID, issuerURL, cfg.fileOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("getting storage backend: %w", err)
 	}
@@ -84,7 +229,7 @@ func GetToken(
 	)
 
 	if cfg.localCacheDir != "" {
-		rootStorage, rootErr := storage.GetOIDC(ctx, clientID, issuerURL)
+		rootStorage, rootErr := cfg.getStorage(ctx, clientID, issuerURL, cfg.rootFileOptions...)
 		if rootErr != nil {
 			logger.Warn("GetToken: failed to get root storage backend, skipping sync with root", "error", rootErr)
 		} else {
@@ -92,38 +237,106 @@ func GetToken(
 		}
 	}
 
-	tokenCache := cache.NewCache(ctx, storageBackend, oidcClient.RefreshToken, fileLock)
-	token, err := tokenCache.Read(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("extracting token from client: %w", err)
+	oidcClient := lazyOIDCClient(clientID, issuerURL, clientOptions)
+	refreshToken := func(ctx context.Context, token *client.Token) (*client.Token, error) {
+		c, err := oidcClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		refreshed, err := c.RefreshToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return refreshed, checkRefreshed(refreshed, cfg.refreshChecks)
 	}
-	if token == nil {
-		return nil, fmt.Errorf("nil token from OIDC-IDP")
+	refreshOnly := func(ctx context.Context, token *client.Token) (*client.Token, error) {
+		c, err := oidcClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		refreshed, err := c.RefreshTokenNonInteractive(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return refreshed, checkRefreshed(refreshed, cfg.refreshChecks)
 	}
 
-	logger.Debug("GetToken: completed",
-		"elapsed_ms", time.Since(startTime).Milliseconds(),
-		"token_expiry", token.Token.Expiry,
-	)
-	return token, nil
+	cacheOptions := append([]cache.CacheOption{cache.WithNonInteractiveRefresh(refreshOnly)}, cfg.cacheOptions...)
+	for _, check := range cfg.tokenChecks {
+		cacheOptions = append(cacheOptions, cache.WithTokenCheck(check))
+	}
+	return cache.NewCache(ctx, storageBackend, refreshToken, fileLock, cacheOptions...), nil
+}
+
+// checkRefreshed runs checks on a refreshed token. The cache neither saves
+// nor returns a token when the refresh function fails.
+func checkRefreshed(token *client.Token, checks []func(*client.Token) error) error {
+	for _, check := range checks {
+		err := check(token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lazyOIDCClient returns a function that only creates the OIDC client
+// (which may require provider discovery over the network) the first time a
+// refresh is needed, so reading a valid cached token works offline. A
+// failed client creation is retried on the next call.
+func lazyOIDCClient(
+	clientID string,
+	issuerURL string,
+	clientOptions []client.OIDCClientOption,
+) func(context.Context) (*client.OIDCClient, error) {
+	var mu sync.Mutex
+	var oidcClient *client.OIDCClient
+
+	return func(ctx context.Context) (*client.OIDCClient, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if oidcClient == nil {
+			logging.FromContext(ctx).Debug("lazyOIDCClient: creating oidc client")
+			c, err := client.NewOIDCClient(ctx, clientID, issuerURL, clientOptions...)
+			if err != nil {
+				return nil, fmt.Errorf("creating oidc client: %w", err)
+			}
+			oidcClient = c
+		}
+		return oidcClient, nil
+	}
 }
 
 // lockFilePath returns a deterministic lock file path derived from clientID
 // and issuerURL. When localCacheDir is set the lock lives there (local disk);
 // otherwise it falls back to the default storage dir (~/.cache/oidc-cli).
 func lockFilePath(clientID, issuerURL, localCacheDir string) (string, error) {
-	dir := localCacheDir
-	if dir == "" {
-		d, err := storage.DefaultStorageDir()
-		if err != nil {
-			return "", fmt.Errorf("determining lock dir: %w", err)
-		}
-		dir = d
+	dir, err := cacheDir(localCacheDir)
+	if err != nil {
+		return "", fmt.Errorf("determining lock dir: %w", err)
 	}
 
 	return fmt.Sprintf("%s.lock", storage.GenerateKey(dir, clientID, issuerURL)), nil
 }
 
+// cacheDir returns localCacheDir if set, otherwise the default storage dir.
+func cacheDir(localCacheDir string) (string, error) {
+	if localCacheDir != "" {
+		return localCacheDir, nil
+	}
+	return storage.DefaultStorageDir()
+}
+
+// Errors returned by CheckTokenIsValid and CheckRefreshTokenTTL, to be
+// checked with errors.Is.
+var (
+	// ErrTokenNotFound means no token (or no refresh token) is cached.
+	ErrTokenNotFound = errors.New("no token in cache")
+	// ErrTokenExpired means the cached access token has expired.
+	ErrTokenExpired = errors.New("cached token expired")
+)
+
 // CheckTokenIsValid reads the cached OIDC token and returns nil if it is present
 // and valid. Returns ErrTokenNotFound or ErrTokenExpired otherwise.
 // It never triggers a refresh flow.
@@ -144,7 +357,7 @@ func CheckTokenIsValid(
 		"issuer_url", issuerURL,
 	)
 
-	storageBackend, err := storage.GetOIDC(ctx, clientID, issuerURL, cfg.fileOptions...)
+	storageBackend, err := cfg.getStorage(ctx, clientID, issuerURL, cfg.fileOptions...)
 	if err != nil {
 		return fmt.Errorf("getting storage backend: %w", err)
 	}
@@ -156,10 +369,10 @@ func CheckTokenIsValid(
 	}
 
 	if cachedToken.AccessToken == "" {
-		return fmt.Errorf("no valid token in cache")
+		return ErrTokenNotFound
 	}
 	if !cachedToken.Valid() {
-		return fmt.Errorf("cached access token expired %s ago", time.Since(cachedToken.Expiry).Truncate(time.Second))
+		return fmt.Errorf("%w: access token expired %s ago", ErrTokenExpired, time.Since(cachedToken.Expiry).Truncate(time.Second))
 	}
 
 	return nil
@@ -185,7 +398,7 @@ func CheckRefreshTokenTTL(
 		"issuer_url", issuerURL,
 	)
 
-	storageBackend, err := storage.GetOIDC(ctx, clientID, issuerURL, cfg.fileOptions...)
+	storageBackend, err := cfg.getStorage(ctx, clientID, issuerURL, cfg.fileOptions...)
 	if err != nil {
 		return 0, fmt.Errorf("getting storage backend: %w", err)
 	}
@@ -201,10 +414,18 @@ func CheckRefreshTokenTTL(
 		expiry = *cachedToken.RefreshTokenExpiry
 	} else {
 		if cachedToken.RefreshToken == "" {
-			return 0, fmt.Errorf("no refresh token in cache to introspect")
+			return 0, fmt.Errorf("%w: no refresh token to introspect", ErrTokenNotFound)
 		}
 		logger.Debug("CheckRefreshTokenTTL: no stored expiry, falling back to introspection")
-		expiry, err = client.LookupRefreshExpiry(ctx, clientID, issuerURL, cachedToken.RefreshToken)
+		clientOptions, err := cfg.oidcClientOptions()
+		if err != nil {
+			return 0, err
+		}
+		oidcClient, err := client.NewOIDCClient(ctx, clientID, issuerURL, clientOptions...)
+		if err != nil {
+			return 0, fmt.Errorf("creating oidc client: %w", err)
+		}
+		expiry, err = oidcClient.LookupRefreshExpiry(ctx, cachedToken.RefreshToken)
 		if err != nil {
 			return 0, fmt.Errorf("introspecting refresh token expiry: %w", err)
 		}
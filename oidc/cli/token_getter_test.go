@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -154,3 +155,76 @@ func TestSyncFromRootIfNewerNoopWhenRootEmpty(t *testing.T) {
 	r.NoError(err)
 	r.Equal("local-access", tok.AccessToken, "local should be unchanged when root is empty")
 }
+
+func TestGetTokenOfflineWithCachedToken(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	// nothing listens here, so any discovery request fails
+	issuerURL := "http://127.0.0.1:1"
+	s := storage.NewMemory(ctx, "offline-client", issuerURL)
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{AccessToken: "cached", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	token, err := GetToken(ctx, "offline-client", issuerURL, WithStorage(storage.BackendMemory))
+	r.NoError(err)
+	r.Equal("cached", token.AccessToken)
+}
+
+func TestGetTokenOfflineRefreshFails(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	issuerURL := "http://127.0.0.1:1"
+	s := storage.NewMemory(ctx, "offline-expired-client", issuerURL)
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)},
+	})
+
+	_, err := GetToken(ctx, "offline-expired-client", issuerURL, WithStorage(storage.BackendMemory))
+	r.Error(err)
+	r.Contains(err.Error(), "creating oidc client")
+	r.ErrorIs(err, client.ErrIdPUnreachable)
+}
+
+func TestCheckTokenIsValidErrors(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+	issuerURL := "https://idp.example.com"
+
+	err := CheckTokenIsValid(ctx, "check-missing-client", issuerURL, WithStorage(storage.BackendMemory))
+	r.ErrorIs(err, ErrTokenNotFound)
+
+	_, err = CheckRefreshTokenTTL(ctx, "check-missing-client", issuerURL, WithStorage(storage.BackendMemory))
+	r.ErrorIs(err, ErrTokenNotFound)
+
+	s := storage.NewMemory(ctx, "check-expired-client", issuerURL)
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{AccessToken: "stale", Expiry: time.Now().Add(-time.Hour)},
+	})
+	err = CheckTokenIsValid(ctx, "check-expired-client", issuerURL, WithStorage(storage.BackendMemory))
+	r.ErrorIs(err, ErrTokenExpired)
+	r.NotErrorIs(err, ErrTokenNotFound)
+}
+
+func TestGetTokenNonInteractive(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	var requests atomic.Int32
+	idp := newFakeTokenExchangeServer(t, &requests)
+	s := storage.NewMemory(ctx, "non-interactive-client", idp.URL)
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{AccessToken: "stale", Expiry: time.Now().Add(-time.Hour)},
+	})
+
+	start := time.Now()
+	_, err := GetToken(ctx, "non-interactive-client", idp.URL, WithStorage(storage.BackendMemory), WithNonInteractive())
+	r.ErrorIs(err, client.ErrInteractiveRequired)
+	r.Less(time.Since(start), 5*time.Second, "should fail fast instead of waiting for a browser")
+}
@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/cache"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/logging"
+	"golang.org/x/oauth2"
+)
+
+// BearerToken selects which token is sent as the bearer token.
+type BearerToken int
+
+const (
+	// BearerAccessToken sends the OAuth2 access token.
+	BearerAccessToken BearerToken = iota
+	// BearerIDToken sends the OIDC ID token.
+	BearerIDToken
+)
+
+func (b BearerToken) String() string {
+	switch b {
+	case BearerAccessToken:
+		return "access_token"
+	case BearerIDToken:
+		return "id_token"
+	default:
+		return fmt.Sprintf("BearerToken(%d)", int(b))
+	}
+}
+
+// OAuth2TokenSource is an oauth2.TokenSource backed by a cache.Cache. The
+// current token is kept in memory and only read through the cache (and
+// refreshed if needed) once it is no longer valid.
+type OAuth2TokenSource struct {
+	ctx    context.Context
+	cache  *cache.Cache
+	bearer BearerToken
+
+	mu      sync.Mutex
+	current *oauth2.Token
+}
+
+var _ oauth2.TokenSource = &OAuth2TokenSource{}
+
+// NewOAuth2TokenSource returns an oauth2.TokenSource that serves either the
+// access token or the ID token from the OIDC cache. It can be passed to
+// oauth2.NewClient, or used with NewTransport to also retry on 401.
+// ctx is used for any refresh triggered by the token source.
+func NewOAuth2TokenSource(
+	ctx context.Context,
+	clientID string,
+	issuerURL string,
+	bearer BearerToken,
+	opts ...GetTokenOption,
+) (*OAuth2TokenSource, error) {
+	var cfg getTokenConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	ctx, logger := logging.NewLogger(ctx)
+	logger.Debug("NewOAuth2TokenSource: started",
+		"client_id", clientID,
+		"issuer_url", issuerURL,
+		"bearer", bearer,
+	)
+
+	if bearer == BearerIDToken {
+		cfg.tokenChecks = append(cfg.tokenChecks, checkIDTokenUnexpired)
+		cfg.refreshChecks = append(cfg.refreshChecks, checkRefreshedIDToken)
+	}
+
+	tokenCache, err := newTokenCache(ctx, clientID, issuerURL, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuth2TokenSource{
+		ctx:    ctx,
+		cache:  tokenCache,
+		bearer: bearer,
+	}, nil
+}
+
+// Token returns the current bearer token, reading through the cache
+// when the in-memory token is missing or expired.
+func (s *OAuth2TokenSource) Token() (*oauth2.Token, error) {
+	return s.token(s.ctx, false)
+}
+
+// token returns the current bearer token. If reread is set, the in-memory
+// token is discarded and the cache is read again.
+func (s *OAuth2TokenSource) token(ctx context.Context, reread bool) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !reread && s.current.Valid() {
+		return s.current, nil
+	}
+
+	token, err := s.cache.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading token from cache: %w", err)
+	}
+	if token == nil {
+		return nil, fmt.Errorf("nil token from OIDC-IDP")
+	}
+
+	bearer, err := bearerFromToken(token, s.bearer)
+	if err != nil {
+		return nil, err
+	}
+	s.current = bearer
+	return bearer, nil
+}
+
+// checkIDTokenUnexpired makes the cache refresh a token whose ID token
+// expired before its access token.
+func checkIDTokenUnexpired(token *client.Token) error {
+	expiry, ok := token.IDTokenExpiry()
+	if ok && !expiry.After(time.Now()) {
+		return fmt.Errorf("ID token expired at %s", expiry)
+	}
+	return nil
+}
+
+// checkRefreshedIDToken rejects a refreshed token whose ID token is still
+// expired, as when the IdP omits the ID token from the refresh response.
+// Only a new login gets a new ID token, so serving or caching it would just
+// refresh again on every call.
+func checkRefreshedIDToken(token *client.Token) error {
+	err := checkIDTokenUnexpired(token)
+	if err != nil {
+		return fmt.Errorf("%w: refresh returned no new ID token: %w", client.ErrInteractiveRequired, err)
+	}
+	return nil
+}
+
+func bearerFromToken(token *client.Token, bearer BearerToken) (*oauth2.Token, error) {
+	var value string
+	expiry := token.Expiry
+	switch bearer {
+	case BearerAccessToken:
+		value = token.AccessToken
+	case BearerIDToken:
+		value = token.IDToken
+		// the ID token's lifetime may differ from the access token's
+		if idTokenExpiry, ok := token.IDTokenExpiry(); ok {
+			expiry = idTokenExpiry
+		}
+	default:
+		return nil, fmt.Errorf("unknown bearer token type %s", bearer)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("cached token has no %s", bearer)
+	}
+
+	return &oauth2.Token{
+		AccessToken: value,
+		TokenType:   "Bearer",
+		Expiry:      expiry,
+	}, nil
+}
+
+// Transport is an http.RoundTripper that adds the bearer token from an
+// OAuth2TokenSource to each request. On a 401 response it re-reads the
+// cache and, if that yields a different token, retries the request once.
+type Transport struct {
+	Source *OAuth2TokenSource
+	// Base is the underlying RoundTripper. http.DefaultTransport is used if nil.
+	Base http.RoundTripper
+}
+
+// NewTransport returns a Transport using source and base.
+func NewTransport(source *OAuth2TokenSource, base http.RoundTripper) *Transport {
+	return &Transport{
+		Source: source,
+		Base:   base,
+	}
+}
+
+// NewHTTPClient returns an *http.Client whose requests carry the selected
+// bearer token from the OIDC cache.
+func NewHTTPClient(
+	ctx context.Context,
+	clientID string,
+	issuerURL string,
+	bearer BearerToken,
+	opts ...GetTokenOption,
+) (*http.Client, error) {
+	source, err := NewOAuth2TokenSource(ctx, clientID, issuerURL, bearer, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: NewTransport(source, nil)}, nil
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must always close the request body, even on errors.
+	reqBodyClosed := false
+	if req.Body != nil {
+		defer func() {
+			if !reqBodyClosed {
+				req.Body.Close()
+			}
+		}()
+	}
+
+	token, err := t.Source.token(req.Context(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBodyClosed = true
+	resp, err := t.base().RoundTrip(authorizedRequest(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The request can only be replayed if its body can be recreated.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	newToken, err := t.Source.token(req.Context(), true)
+	if err != nil || newToken.AccessToken == token.AccessToken {
+		logging.FromContext(t.Source.ctx).Debug("Transport.RoundTrip: 401 and no newer token in cache",
+			"url", req.URL.Redacted(),
+			"error", err,
+		)
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	resp.Body.Close()
+
+	logging.FromContext(t.Source.ctx).Debug("Transport.RoundTrip: 401, retrying with newer token from cache",
+		"url", req.URL.Redacted(),
+	)
+	return t.base().RoundTrip(authorizedRequest(retry, newToken))
+}
+
+// authorizedRequest returns a shallow clone of req with the Authorization
+// header set, since RoundTrippers must not modify the original request.
+func authorizedRequest(req *http.Request, token *oauth2.Token) *http.Request {
+	r := req.Clone(req.Context())
+	r.Body = req.Body
+	token.SetAuthHeader(r)
+	return r
+}
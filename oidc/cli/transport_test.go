@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/cache"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/client"
+	"github.com/chanzuckerberg/go-misc/oidc/v5/cli/storage"
+	"github.com/chanzuckerberg/go-misc/pidlock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func newTestTokenSource(t *testing.T, s storage.Storage, bearer BearerToken) *OAuth2TokenSource {
+	t.Helper()
+	ctx := context.Background()
+
+	refresh := func(context.Context, *client.Token) (*client.Token, error) {
+		return nil, fmt.Errorf("refresh should not be called")
+	}
+	return &OAuth2TokenSource{
+		ctx:    ctx,
+		cache:  cache.NewCache(ctx, s, refresh, nil),
+		bearer: bearer,
+	}
+}
+
+func TestOAuth2TokenSourceBearer(t *testing.T) {
+	r := require.New(t)
+	s := storage.NewMemory(context.Background(), uuid.NewString(), "issuer")
+	storeToken(t, s, &client.Token{
+		IDToken: "my-id-token",
+		Token: &oauth2.Token{
+			AccessToken: "my-access-token",
+			Expiry:      time.Now().Add(time.Hour),
+		},
+	})
+
+	tok, err := newTestTokenSource(t, s, BearerAccessToken).Token()
+	r.NoError(err)
+	r.Equal("my-access-token", tok.AccessToken)
+	r.Equal("Bearer", tok.TokenType)
+
+	tok, err = newTestTokenSource(t, s, BearerIDToken).Token()
+	r.NoError(err)
+	r.Equal("my-id-token", tok.AccessToken)
+}
+
+// testIDToken returns an unsigned JWT expiring at exp.
+func testIDToken(exp time.Time) string {
+	payload := fmt.Sprintf(`{"sub":"user","exp":%d}`, exp.Unix())
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestOAuth2TokenSourceIDTokenExpiry(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	s := storage.NewMemory(ctx, uuid.NewString(), "issuer")
+
+	idTokenExpiry := time.Now().Add(time.Minute).Truncate(time.Second)
+	storeToken(t, s, &client.Token{
+		IDToken: testIDToken(idTokenExpiry),
+		Token:   &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	})
+	tok, err := newTestTokenSource(t, s, BearerIDToken).Token()
+	r.NoError(err)
+	r.True(idTokenExpiry.Equal(tok.Expiry), "expiry should be the ID token's, got %s", tok.Expiry)
+
+	// an ID token expiring before the access token is refreshed
+	storeToken(t, s, &client.Token{
+		IDToken: testIDToken(time.Now().Add(-time.Minute)),
+		Token:   &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	})
+	fresh := testIDToken(time.Now().Add(time.Hour))
+	refresh := func(context.Context, *client.Token) (*client.Token, error) {
+		return &client.Token{
+			IDToken: fresh,
+			Token:   &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+		}, nil
+	}
+	fileLock, err := pidlock.NewLock(filepath.Join(t.TempDir(), "lock"))
+	r.NoError(err)
+	source := &OAuth2TokenSource{
+		ctx:    ctx,
+		cache:  cache.NewCache(ctx, s, refresh, fileLock, cache.WithTokenCheck(checkIDTokenUnexpired)),
+		bearer: BearerIDToken,
+	}
+	tok, err = source.Token()
+	r.NoError(err)
+	r.Equal(fresh, tok.AccessToken)
+}
+
+func TestOAuth2TokenSourceRefreshWithoutIDToken(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+
+	// the token endpoint never returns an ID token
+	var refreshes atomic.Int32
+	idp := newFakeTokenExchangeServer(t, &refreshes)
+	clientID := uuid.NewString()
+	expiredIDToken := testIDToken(time.Now().Add(-time.Minute))
+	s := storage.NewMemory(ctx, clientID, idp.URL)
+	storeToken(t, s, &client.Token{
+		IDToken: expiredIDToken,
+		Token:   &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)},
+	})
+
+	source, err := NewOAuth2TokenSource(ctx, clientID, idp.URL, BearerIDToken,
+		WithStorage(storage.BackendMemory),
+		WithClientOptions(client.WithRefreshRetryPolicy(client.RefreshRetryPolicy{AcceptMissingIDToken: true})),
+	)
+	r.NoError(err)
+	_, err = source.Token()
+	r.ErrorIs(err, client.ErrInteractiveRequired)
+	r.Equal(int32(1), refreshes.Load())
+
+	// the expired ID token was not cached as if it were refreshed
+	cached, err := cache.NewCache(ctx, s, nil, nil).DecodeFromStorage(ctx)
+	r.NoError(err)
+	r.Equal("access", cached.AccessToken)
+	r.Equal(expiredIDToken, cached.IDToken)
+}
+
+func TestTransportRetriesOn401WithNewerToken(t *testing.T) {
+	r := require.New(t)
+	s := storage.NewMemory(context.Background(), uuid.NewString(), "issuer")
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{AccessToken: "old", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if req.Header.Get("Authorization") != "Bearer new" {
+			// simulate another process refreshing the cache
+			storeToken(t, s, &client.Token{
+				Token: &oauth2.Token{AccessToken: "new", Expiry: time.Now().Add(time.Hour)},
+			})
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	httpClient := &http.Client{Transport: NewTransport(newTestTokenSource(t, s, BearerAccessToken), nil)}
+	resp, err := httpClient.Post(srv.URL, "text/plain", strings.NewReader("body"))
+	r.NoError(err)
+	defer resp.Body.Close()
+
+	r.Equal(http.StatusOK, resp.StatusCode)
+	r.Equal(2, calls)
+}
+
+func TestTransport401WithSameToken(t *testing.T) {
+	r := require.New(t)
+	s := storage.NewMemory(context.Background(), uuid.NewString(), "issuer")
+	storeToken(t, s, &client.Token{
+		Token: &oauth2.Token{AccessToken: "revoked", Expiry: time.Now().Add(time.Hour)},
+	})
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	httpClient := &http.Client{Transport: NewTransport(newTestTokenSource(t, s, BearerAccessToken), nil)}
+	resp, err := httpClient.Get(srv.URL)
+	r.NoError(err)
+	defer resp.Body.Close()
+
+	r.Equal(http.StatusUnauthorized, resp.StatusCode)
+	r.Equal(1, calls)
+}